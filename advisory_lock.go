@@ -0,0 +1,55 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// AcquireAdvisoryLock acquires the session-level advisory lock for the key
+// on a dedicated connection to the database, waiting until it is available.
+// It lets parallel tests sharing a database serialize critical sections.
+//
+// The connection stays checked out while the lock is held, since
+// the lock belongs to its session. The returned release function unlocks
+// the key and returns the connection to the pool; it must be called exactly
+// once, later calls are no-ops. If unlocking fails, the connection is closed
+// so that the server releases the lock. The pool is created if it does not
+// exist yet.
+func (p *ConnectionProvider) AcquireAdvisoryLock(ctx context.Context, databaseName string, key int64) (release func() error, err error) {
+	entry, err := p.getOrCreateEntry(ctx, databaseName)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := p.acquire(ctx, databaseName, entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+		// The lock may have been granted just as the context expired.
+		conn.Conn().Close(context.Background())
+		conn.Release()
+		return nil, fmt.Errorf("failed to acquire advisory lock %d: %w", key, err)
+	}
+
+	var once sync.Once
+	return func() error {
+		var unlockErr error
+		once.Do(func() {
+			defer conn.Release()
+
+			var unlocked bool
+			err := conn.QueryRow(context.Background(), "SELECT pg_advisory_unlock($1)", key).Scan(&unlocked)
+			if err == nil && !unlocked {
+				err = errors.New("lock was not held")
+			}
+			if err != nil {
+				conn.Conn().Close(context.Background())
+				unlockErr = fmt.Errorf("failed to release advisory lock %d: %w", key, err)
+			}
+		})
+		return unlockErr
+	}, nil
+}
@@ -0,0 +1,79 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestAcquireAdvisoryLock(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	key := time.Now().UnixNano()
+
+	c.Run("Contending goroutines are serialized", func(c *qt.C) {
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		var (
+			wg         sync.WaitGroup
+			holders    atomic.Int32
+			overlapped atomic.Bool
+		)
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				release, err := provider.AcquireAdvisoryLock(ctx, "postgres", key)
+				c.Check(err, qt.IsNil)
+				if err != nil {
+					return
+				}
+
+				if holders.Add(1) > 1 {
+					overlapped.Store(true)
+				}
+				time.Sleep(100 * time.Millisecond)
+				holders.Add(-1)
+
+				c.Check(release(), qt.IsNil)
+			}()
+		}
+		wg.Wait()
+		c.Assert(overlapped.Load(), qt.IsFalse)
+
+		stat, err := provider.Stats("postgres")
+		c.Assert(err, qt.IsNil)
+		c.Assert(stat.AcquiredConns(), qt.Equals, int32(0))
+	})
+
+	c.Run("Waiting for a held lock honors the context", func(c *qt.C) {
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		release, err := provider.AcquireAdvisoryLock(ctx, "postgres", key)
+		c.Assert(err, qt.IsNil)
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		_, err = provider.AcquireAdvisoryLock(timeoutCtx, "postgres", key)
+		c.Assert(err, qt.ErrorMatches, "failed to acquire advisory lock .*")
+
+		c.Assert(release(), qt.IsNil)
+		// Releasing twice is a no-op.
+		c.Assert(release(), qt.IsNil)
+
+		// The lock is available again.
+		release, err = provider.AcquireAdvisoryLock(ctx, "postgres", key)
+		c.Assert(err, qt.IsNil)
+		c.Assert(release(), qt.IsNil)
+	})
+}
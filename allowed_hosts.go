@@ -0,0 +1,44 @@
+package pgdbtemplatepgxv4
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// ErrHostNotAllowed is returned by Connect when the connection string
+// for a database points to a host missing from the allowlist set via
+// WithAllowedHosts.
+var ErrHostNotAllowed = errors.New("host not allowed")
+
+// checkAllowedHosts returns ErrHostNotAllowed if the config, including
+// its fallbacks, points to a host missing from the allowlist.
+func (p *ConnectionProvider) checkAllowedHosts(config *pgxpool.Config) error {
+	if len(p.allowedHosts) == 0 {
+		return nil
+	}
+
+	hosts := []string{config.ConnConfig.Host}
+	for _, fallback := range config.ConnConfig.Fallbacks {
+		hosts = append(hosts, fallback.Host)
+	}
+	for _, host := range hosts {
+		if !p.hostAllowed(host) {
+			return fmt.Errorf("%w: %q", ErrHostNotAllowed, host)
+		}
+	}
+	return nil
+}
+
+// hostAllowed reports whether the host is in the allowlist.
+// Host names are compared case-insensitively.
+func (p *ConnectionProvider) hostAllowed(host string) bool {
+	for _, allowed := range p.allowedHosts {
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
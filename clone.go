@@ -0,0 +1,41 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgconn"
+)
+
+// ErrTemplateInUse is returned by CreateDatabaseFromTemplate when the
+// template database has other sessions connected, which PostgreSQL
+// does not allow while copying it.
+var ErrTemplateInUse = errors.New("template database is in use")
+
+// objectInUseCode is the SQLSTATE of object_in_use errors.
+const objectInUseCode = "55006"
+
+// CreateDatabaseFromTemplate creates the database newName as a copy of
+// the database templateName, through the provider's maintenance database.
+//
+// It gives direct access to the cloning primitive for workflows outside
+// pgdbtemplate.TemplateManager. Both names are quoted as identifiers.
+// ErrTemplateInUse is returned if the template has other sessions
+// connected, including pools of this provider.
+func (p *ConnectionProvider) CreateDatabaseFromTemplate(ctx context.Context, newName, templateName string) error {
+	entry, err := p.getOrCreateEntry(ctx, p.maintenanceDatabase)
+	if err != nil {
+		return err
+	}
+
+	_, err = entry.pool.Exec(ctx, "CREATE DATABASE "+QuoteIdentifier(newName)+" TEMPLATE "+QuoteIdentifier(templateName))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == objectInUseCode {
+		return fmt.Errorf("%w: %q: %w", ErrTemplateInUse, templateName, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create database %q from template %q: %w", newName, templateName, err)
+	}
+	return nil
+}
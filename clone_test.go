@@ -0,0 +1,80 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestCreateDatabaseFromTemplate(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	c.Run("Database is cloned from the template", func(c *qt.C) {
+		c.Parallel()
+		suffix := time.Now().UnixNano()
+		templateName := fmt.Sprintf("clone_template_%d", suffix)
+		cloneName := fmt.Sprintf("clone_copy_%d", suffix)
+
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		// template0 never has sessions connected, so it is always safe to copy.
+		err := provider.CreateDatabaseFromTemplate(ctx, templateName, "template0")
+		c.Assert(err, qt.IsNil)
+		defer dropDatabase(c, provider, templateName)
+
+		conn, err := provider.Connect(ctx, templateName)
+		c.Assert(err, qt.IsNil)
+		_, err = conn.ExecContext(ctx, "CREATE TABLE cloned (id INT)")
+		c.Assert(err, qt.IsNil)
+		c.Assert(conn.Close(), qt.IsNil)
+
+		err = provider.CreateDatabaseFromTemplate(ctx, cloneName, templateName)
+		c.Assert(err, qt.IsNil)
+		defer dropDatabase(c, provider, cloneName)
+
+		conn, err = provider.Connect(ctx, cloneName)
+		c.Assert(err, qt.IsNil)
+		defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+
+		var exists bool
+		err = conn.QueryRowContext(ctx, "SELECT to_regclass('cloned') IS NOT NULL").Scan(&exists)
+		c.Assert(err, qt.IsNil)
+		c.Assert(exists, qt.IsTrue)
+	})
+
+	c.Run("Template in use", func(c *qt.C) {
+		c.Parallel()
+		suffix := time.Now().UnixNano()
+		templateName := fmt.Sprintf("clone_busy_template_%d", suffix)
+
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		err := provider.CreateDatabaseFromTemplate(ctx, templateName, "template0")
+		c.Assert(err, qt.IsNil)
+		defer dropDatabase(c, provider, templateName)
+
+		conn, err := provider.Connect(ctx, templateName)
+		c.Assert(err, qt.IsNil)
+
+		err = provider.CreateDatabaseFromTemplate(ctx, fmt.Sprintf("clone_busy_copy_%d", suffix), templateName)
+		c.Assert(err, qt.ErrorIs, pgdbtemplatepgx.ErrTemplateInUse)
+		c.Assert(conn.Close(), qt.IsNil)
+	})
+}
+
+// dropDatabase drops the database through the provider's maintenance database.
+func dropDatabase(c *qt.C, provider *pgdbtemplatepgx.ConnectionProvider, dbName string) {
+	conn, err := provider.Connect(context.Background(), "postgres")
+	c.Assert(err, qt.IsNil)
+	_, err = conn.ExecContext(context.Background(), "DROP DATABASE "+pgdbtemplatepgx.QuoteIdentifier(dbName))
+	c.Assert(err, qt.IsNil)
+}
@@ -0,0 +1,78 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/andrei-polukhin/pgdbtemplate"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// ConnHandle is a single connection acquired from a provider's pool.
+//
+// Unlike DatabaseConnection, which spreads queries across the pool,
+// every query through a ConnHandle runs on the same backend until
+// Release is called. It is an escape hatch for pgx-native features
+// that need the underlying connection (e.g. large objects).
+type ConnHandle struct {
+	conn        *pgxpool.Conn
+	releaseOnce sync.Once
+}
+
+// AcquireConn acquires a single connection to the database.
+//
+// The pool is created if it does not exist yet.
+// The caller must call Release when done with the connection.
+func (p *ConnectionProvider) AcquireConn(ctx context.Context, databaseName string) (*ConnHandle, error) {
+	entry, err := p.getOrCreateEntry(ctx, databaseName)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := p.acquire(ctx, databaseName, entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	return &ConnHandle{conn: conn}, nil
+}
+
+// ExecContext executes a query on the acquired connection.
+func (h *ConnHandle) ExecContext(ctx context.Context, query string, args ...any) (any, error) {
+	return h.conn.Exec(ctx, query, args...)
+}
+
+// QueryRowContext executes a query that is expected to return
+// a single row on the acquired connection.
+func (h *ConnHandle) QueryRowContext(ctx context.Context, query string, args ...any) pgdbtemplate.Row {
+	return h.conn.QueryRow(ctx, query, args...)
+}
+
+// CancelRunningQuery asks the server to cancel the query currently
+// running on the connection, if any, through an out-of-band cancel request.
+//
+// It is meant to be called concurrently with the query, e.g. to test how
+// code handles cancelled queries: the cancelled query fails with
+// SQLSTATE 57014 (query_canceled). Returning without error only means
+// that the request has been sent, not that a query has been cancelled.
+func (h *ConnHandle) CancelRunningQuery(ctx context.Context) error {
+	if err := h.conn.Conn().PgConn().CancelRequest(ctx); err != nil {
+		return fmt.Errorf("failed to cancel query: %w", err)
+	}
+	return nil
+}
+
+// Raw returns the underlying pgx connection.
+//
+// The returned connection must not be used after Release.
+func (h *ConnHandle) Raw() *pgx.Conn {
+	return h.conn.Conn()
+}
+
+// Release returns the connection to the pool.
+//
+// It is safe to call Release more than once.
+func (h *ConnHandle) Release() {
+	h.releaseOnce.Do(h.conn.Release)
+}
@@ -0,0 +1,109 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/jackc/pgconn"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestAcquireConn(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	c.Run("Raw exposes the pgx connection", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		handle, err := provider.AcquireConn(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer handle.Release()
+
+		// The backend PID reported by pgx matches the one seen by the server,
+		// proving that queries run on the very same connection.
+		var backendPID uint32
+		err = handle.QueryRowContext(ctx, "SELECT pg_backend_pid()").Scan(&backendPID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(handle.Raw().PgConn().PID(), qt.Equals, backendPID)
+
+		_, err = handle.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.IsNil)
+	})
+
+	c.Run("Release is idempotent", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer conn.Close()
+		pgxConn, ok := conn.(*pgdbtemplatepgx.DatabaseConnection)
+		c.Assert(ok, qt.IsTrue)
+
+		handle, err := provider.AcquireConn(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		c.Assert(pgxConn.Pool.Stat().AcquiredConns(), qt.Equals, int32(1))
+
+		handle.Release()
+		handle.Release()
+		c.Assert(pgxConn.Pool.Stat().AcquiredConns(), qt.Equals, int32(0))
+	})
+
+	c.Run("CancelRunningQuery cancels a long query", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer conn.Close()
+
+		handle, err := provider.AcquireConn(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer handle.Release()
+		pid := handle.Raw().PgConn().PID()
+
+		queryErr := make(chan error, 1)
+		go func() {
+			_, err := handle.ExecContext(ctx, "SELECT pg_sleep(30)")
+			queryErr <- err
+		}()
+
+		// Wait for the query to be running before cancelling it.
+		for {
+			var running bool
+			err := conn.QueryRowContext(ctx,
+				"SELECT EXISTS (SELECT 1 FROM pg_stat_activity WHERE pid = $1 AND state = 'active' AND query LIKE '%pg_sleep%')",
+				int64(pid),
+			).Scan(&running)
+			c.Assert(err, qt.IsNil)
+			if running {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		c.Assert(handle.CancelRunningQuery(ctx), qt.IsNil)
+
+		select {
+		case err := <-queryErr:
+			var pgErr *pgconn.PgError
+			c.Assert(errors.As(err, &pgErr), qt.IsTrue, qt.Commentf("error: %v", err))
+			c.Assert(pgErr.Code, qt.Equals, "57014")
+		case <-time.After(10 * time.Second):
+			c.Fatal("query has not been cancelled")
+		}
+
+		// The connection stays usable after the cancellation.
+		_, err = handle.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.IsNil)
+	})
+}
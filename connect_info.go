@@ -0,0 +1,42 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"time"
+
+	"github.com/andrei-polukhin/pgdbtemplate"
+)
+
+// ConnectInfo describes how ConnectWithInfo obtained its pool.
+type ConnectInfo struct {
+	// Created is true if the pool has been created by the call,
+	// false if a cached pool has been reused.
+	Created bool
+	// ParseDuration is the time spent building the pool configuration.
+	ParseDuration time.Duration
+	// DialDuration is the time spent opening the pool,
+	// including its initial connections.
+	DialDuration time.Duration
+	// PingDuration is the time spent checking the pool is ready.
+	PingDuration time.Duration
+}
+
+// ConnectWithInfo is like Connect, but also reports whether the pool
+// has been created and how long each step of its creation took,
+// e.g. to find out whether slow tests are slow to connect.
+//
+// Durations include every retry and are zero if a cached pool
+// has been reused.
+func (p *ConnectionProvider) ConnectWithInfo(ctx context.Context, databaseName string) (pgdbtemplate.DatabaseConnection, ConnectInfo, error) {
+	entry, created, err := p.getOrCreate(ctx, databaseName)
+	if err != nil {
+		return nil, ConnectInfo{}, err
+	}
+
+	var info ConnectInfo
+	if created {
+		info = entry.connectInfo
+		info.Created = true
+	}
+	return p.newConnection(databaseName, entry), info, nil
+}
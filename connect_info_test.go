@@ -0,0 +1,33 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestConnectWithInfo(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+	defer provider.Close()
+
+	conn, info, err := provider.ConnectWithInfo(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+	defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+
+	c.Assert(info.Created, qt.IsTrue)
+	c.Assert(info.ParseDuration > 0, qt.IsTrue, qt.Commentf("parse: %v", info.ParseDuration))
+	c.Assert(info.DialDuration > 0, qt.IsTrue, qt.Commentf("dial: %v", info.DialDuration))
+	c.Assert(info.PingDuration > 0, qt.IsTrue, qt.Commentf("ping: %v", info.PingDuration))
+
+	// The cached pool is reused without timings.
+	_, info, err = provider.ConnectWithInfo(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+	c.Assert(info, qt.Equals, pgdbtemplatepgx.ConnectInfo{})
+}
@@ -2,12 +2,98 @@ package pgdbtemplatepgxv4
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/andrei-polukhin/pgdbtemplate"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgtype"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// PoolError reports a failure of a pool-level operation
+// (AfterConnect, BeforeAcquire or a health check) for a database.
+type PoolError struct {
+	// DatabaseName is the database whose pool failed.
+	DatabaseName string
+	// Err is the underlying failure.
+	Err error
+}
+
+// Error implements the error interface.
+func (e PoolError) Error() string {
+	return fmt.Sprintf("pool error for database %q: %v", e.DatabaseName, e.Err)
+}
+
+// Unwrap returns the underlying failure.
+func (e PoolError) Unwrap() error {
+	return e.Err
+}
+
+// ErrPoolConfigConflict is returned by Connect in strict pool config mode
+// when the same pool parameter is set both in the connection string
+// and via a ConnectionOption.
+var ErrPoolConfigConflict = errors.New("pool configuration conflict")
+
+// Operation tags passed to the function set via WithErrorWrapper.
+const (
+	// OpParse tags failures to parse the connection string.
+	OpParse = "parse"
+	// OpConnect tags failures to create a connection pool.
+	OpConnect = "connect"
+	// OpPing tags failures of the health check of a new pool.
+	OpPing = "ping"
+)
+
+// ErrProviderDraining is returned by Connect once Drain has been called.
+var ErrProviderDraining = errors.New("connection provider is draining")
+
+// ErrNilConnectionStringFunc is returned by Connect when the provider
+// has been created with a nil connectionStringFunc.
+var ErrNilConnectionStringFunc = errors.New("connectionStringFunc is nil")
+
+// ErrGSSEncryptionUnsupported is returned by Connect when WithGSSEncMode
+// requires GSSAPI encryption, which pgx v4 does not implement.
+var ErrGSSEncryptionUnsupported = errors.New("GSSAPI encryption is not supported by pgx v4")
+
+// ErrAcquireTimeout is returned by ExecContextAcquire when no connection
+// could be acquired from the pool within the acquire timeout.
+var ErrAcquireTimeout = errors.New("timed out acquiring connection")
+
+// ErrPoolNotFound is returned by methods that operate on an existing pool
+// when the provider has no pool for the requested database.
+var ErrPoolNotFound = errors.New("no pool for database")
+
+// ErrPoolAlreadyClosed is returned by DatabaseConnection.Close
+// when the pool of the connection has already been closed.
+var ErrPoolAlreadyClosed = errors.New("connection pool already closed")
+
+// ErrCloseTimeout is returned by Close when a pool has not finished closing
+// within the timeout set via WithCloseTimeout.
+var ErrCloseTimeout = errors.New("timed out closing connection pool")
+
+const (
+	// defaultMaintenanceDatabase is the database used for maintenance
+	// operations such as CREATE DATABASE, per PostgreSQL conventions.
+	defaultMaintenanceDatabase = "postgres"
+	// drainPollInterval is how often Drain checks whether the pools are idle.
+	drainPollInterval = 10 * time.Millisecond
+	// healthyTimeout bounds the health check performed by Healthy.
+	healthyTimeout = 5 * time.Second
+	// undefinedDatabaseCode is the SQLSTATE of invalid_catalog_name,
+	// returned when connecting to a database that does not exist.
+	undefinedDatabaseCode = "3D000"
+	// duplicateDatabaseCode is the SQLSTATE returned by CREATE DATABASE
+	// for a database that already exists.
+	duplicateDatabaseCode = "42P04"
 )
 
 // ConnectionProvider implements pgdbtemplate.ConnectionProvider
@@ -16,74 +102,795 @@ type ConnectionProvider struct {
 	connectionStringFunc func(string) string
 	poolConfig           pgxpool.Config
 
-	mu    sync.RWMutex
-	pools map[string]*pgxpool.Pool
+	afterConnectAttempts int
+	afterConnectBackoff  time.Duration
+	strictPoolConfig     bool
+	connectAttempts      int
+	connectBackoff       time.Duration
+	pingFailurePolicy    PingFailurePolicy
+	errorWrapper         func(op string, err error) error
+	sslMode              string
+	gssEncMode           string
+	searchPath           []string
+	pingQuery            *string
+	errorChannel         chan<- PoolError
+	closeTimeout         time.Duration
+	idlePoolTimeout      time.Duration
+	readOnly             bool
+	autoCreateFrom       string
+	poolConfigFunc       func(databaseName string, config *pgxpool.Config)
+	statementTimeout     *time.Duration
+	lockTimeout          *time.Duration
+	logger               pgx.Logger
+	contextLoggerFunc    func(ctx context.Context) pgx.Logger
+	prewarmConcurrency   int
+	readinessProbe       *readinessProbe
+	preferSimpleProtocol bool
+	queryMiddlewares     []func(next QueryFunc) QueryFunc
+	meter                metric.Meter
+	metrics              *providerMetrics
+	validateServerLimits bool
+	hardClose            bool
+	connInfoSetup        func(*pgtype.ConnInfo)
+	isolationLevel       string
+	onAcquireSQL         string
+	leaks                *leakDetector
+	allowedHosts         []string
+
+	reconnectOnAdminShutdown bool
+	cancelInFlightOnClose    bool
+
+	maintenanceDatabase             string
+	maintenanceContextFunc          func(parent context.Context) (context.Context, context.CancelFunc)
+	maintenanceConnectionStringFunc func() string
+	sharedMaintenancePool           *pgxpool.Pool
+
+	// clock is replaced in tests to control time.
+	clock clock
+
+	// pingHook runs before each pool health check.
+	// It is used by tests to simulate ping failures.
+	pingHook func(ctx context.Context) error
+
+	// opts are the options the provider has been created with,
+	// replayed by providers derived from it.
+	opts []ConnectionOption
+
+	// serverMaxConns is the server's max_connections,
+	// read once if WithValidateAgainstServerLimits has been used.
+	serverMaxConns atomic.Int32
+
+	mu        sync.RWMutex
+	pools     map[string]*poolEntry
+	creations map[string]*poolCreation
+	draining  bool
+	// replaced holds the database names of the pools replaced by
+	// ReconfigureDatabase that still have open handles.
+	replaced map[*poolEntry]string
+
+	// paused holds the names of the databases paused via PausePool.
+	paused sync.Map
+}
+
+// readinessProbe is the verification of new pools set via WithReadinessProbe.
+type readinessProbe struct {
+	attempts int
+	interval time.Duration
+	query    string
+}
+
+// poolEntry is a cached pool together with its usage bookkeeping.
+type poolEntry struct {
+	pool     *pgxpool.Pool
+	lastUsed atomic.Int64 // Unix nanoseconds.
+
+	// execCount and queryCount count the ExecContext and QueryRowContext
+	// calls through DatabaseConnection handles of the pool.
+	execCount  atomic.Int64
+	queryCount atomic.Int64
+
+	// reuseCount counts how many times the cached pool has been
+	// returned instead of creating a new one.
+	reuseCount atomic.Int64
+	// retired is closed once the entry is no longer managed by the provider.
+	retired    chan struct{}
+	retireOnce sync.Once
+
+	// conns tracks the connections of the pool if WithHardClose
+	// or WithCancelInFlightOnClose is used.
+	conns *connTracker
+	// hardClose is true if the pool is closed with WithHardClose semantics.
+	hardClose bool
+	// connectInfo is how the pool has been created.
+	connectInfo ConnectInfo
+	// shared is true if the pool is not owned by the provider
+	// (see WithSharedMaintenancePool) and must not be closed by it.
+	shared bool
+	// external is true if the pool has not been configured by the provider,
+	// e.g. one added via RegisterPool, and so lacks its hooks.
+	external bool
+
+	// handles counts the DatabaseConnection handles of the pool
+	// not closed yet, so that a pool replaced by ReconfigureDatabase
+	// is closed with its last handle.
+	handles atomic.Int64
+	// replaced is true once ReconfigureDatabase has replaced the pool.
+	// It is guarded by the provider's mu.
+	replaced bool
+}
+
+// newEntry returns a new pool entry for the pool, marked as used now.
+func (p *ConnectionProvider) newEntry(pool *pgxpool.Pool) *poolEntry {
+	entry := &poolEntry{
+		pool:    pool,
+		retired: make(chan struct{}),
+	}
+	entry.touch(p.clock.Now())
+	return entry
+}
+
+// close retires the entry and closes its pool, unless the pool is shared.
+//
+// With WithHardClose, the connections of the pool are closed at once,
+// including those still checked out, and close does not wait for
+// the latter to be released.
+func (e *poolEntry) close() {
+	e.retire()
+	if e.shared {
+		return
+	}
+	if e.hardClose {
+		e.conns.closeAll()
+		go e.pool.Close()
+		return
+	}
+	e.pool.Close()
+}
+
+// forceClose closes the network connections of the pool, if tracked,
+// so that the server ends their sessions while close still waits
+// for connections checked out by callers to be released.
+func (e *poolEntry) forceClose() {
+	if e.conns != nil {
+		e.conns.closeAll()
+	}
+}
+
+// retire signals that the entry is no longer managed by the provider.
+func (e *poolEntry) retire() {
+	e.retireOnce.Do(func() {
+		close(e.retired)
+	})
+}
+
+// touch records that the pool has been used at the given time.
+func (e *poolEntry) touch(now time.Time) {
+	e.lastUsed.Store(now.UnixNano())
+}
+
+// lastUsedAt returns when the pool has last been used.
+func (e *poolEntry) lastUsedAt() time.Time {
+	return time.Unix(0, e.lastUsed.Load())
+}
+
+// clock abstracts the current time so that time-based logic
+// can be driven deterministically in tests.
+type clock interface {
+	Now() time.Time
+	// AfterFunc calls f in its own goroutine once d has elapsed.
+	AfterFunc(d time.Duration, f func())
+}
+
+// realClock is the clock used outside of tests.
+type realClock struct{}
+
+// Now implements clock.Now.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// AfterFunc implements clock.AfterFunc.
+func (realClock) AfterFunc(d time.Duration, f func()) {
+	time.AfterFunc(d, f)
 }
 
 // NewConnectionProvider creates a new pgx-based connection provider.
 func NewConnectionProvider(connectionStringFunc func(string) string, opts ...ConnectionOption) *ConnectionProvider {
 	provider := &ConnectionProvider{
 		connectionStringFunc: connectionStringFunc,
-		pools:                make(map[string]*pgxpool.Pool),
+		pools:                make(map[string]*poolEntry),
+		creations:            make(map[string]*poolCreation),
+		replaced:             make(map[*poolEntry]string),
+		maintenanceDatabase:  defaultMaintenanceDatabase,
+		clock:                realClock{},
+		opts:                 opts,
 	}
 
 	for _, opt := range opts {
 		opt(provider)
 	}
+	if provider.meter != nil {
+		provider.metrics = newProviderMetrics(provider, provider.meter)
+	}
 	return provider
 }
 
 // Connect implements pgdbtemplate.ConnectionProvider.Connect.
+//
+// Concurrent calls for a database without a cached pool share a single
+// pool creation, which runs without holding the provider's lock.
+// If the context of the call running the creation is cancelled,
+// the waiting calls do not share its failure: one of them retries
+// the creation with its own context. A waiting call whose own context
+// is done gives up without affecting the creation.
 func (p *ConnectionProvider) Connect(ctx context.Context, databaseName string) (pgdbtemplate.DatabaseConnection, error) {
+	entry, err := p.getOrCreateEntry(ctx, databaseName)
+	if err != nil {
+		return nil, err
+	}
+	return p.newConnection(databaseName, entry), nil
+}
+
+// newConnection returns a new DatabaseConnection handle of the entry.
+func (p *ConnectionProvider) newConnection(databaseName string, entry *poolEntry) *DatabaseConnection {
+	entry.handles.Add(1)
+	return &DatabaseConnection{
+		Pool:     entry.pool,
+		provider: p,
+		dbName:   databaseName,
+		entry:    entry,
+	}
+}
+
+// queryConnection returns a DatabaseConnection for the provider's own
+// queries on the pool of the entry, e.g. by ExecAll, so that they are
+// run like those of DatabaseConnection handles. Unlike the connections
+// returned by newConnection, it is not a handle of the pool and must
+// not be closed.
+func (p *ConnectionProvider) queryConnection(databaseName string, entry *poolEntry) *DatabaseConnection {
+	return &DatabaseConnection{
+		Pool:     entry.pool,
+		provider: p,
+		dbName:   databaseName,
+		entry:    entry,
+	}
+}
+
+// getOrCreateEntry returns the cached pool entry for the database,
+// creating and caching a new pool if none exists yet.
+//
+// The entry is marked as used.
+func (p *ConnectionProvider) getOrCreateEntry(ctx context.Context, databaseName string) (*poolEntry, error) {
+	entry, _, err := p.getOrCreate(ctx, databaseName)
+	return entry, err
+}
+
+// getOrCreate is like getOrCreateEntry, but also reports whether
+// the pool has been created by this call.
+func (p *ConnectionProvider) getOrCreate(ctx context.Context, databaseName string) (_ *poolEntry, created bool, _ error) {
 	// Check if we already have a pool for this database.
 	p.mu.RLock()
-	if pool, exists := p.pools[databaseName]; exists {
+	if p.draining {
+		p.mu.RUnlock()
+		return nil, false, ErrProviderDraining
+	}
+	if err := p.checkPaused(databaseName); err != nil {
+		p.mu.RUnlock()
+		return nil, false, err
+	}
+	if entry, exists := p.pools[databaseName]; exists {
 		p.mu.RUnlock()
-		return &DatabaseConnection{
-			Pool:     pool,
-			provider: p,
-			dbName:   databaseName,
-		}, nil
+		entry.touch(p.clock.Now())
+		entry.reuseCount.Add(1)
+		return entry, false, nil
 	}
 	p.mu.RUnlock()
 
-	// Create new pool.
+	for {
+		p.mu.Lock()
+
+		// Double-check after acquiring write lock.
+		if p.draining {
+			p.mu.Unlock()
+			return nil, false, ErrProviderDraining
+		}
+		if err := p.checkPaused(databaseName); err != nil {
+			p.mu.Unlock()
+			return nil, false, err
+		}
+		if entry, exists := p.pools[databaseName]; exists {
+			p.mu.Unlock()
+			entry.touch(p.clock.Now())
+			entry.reuseCount.Add(1)
+			return entry, false, nil
+		}
+
+		creation, inFlight := p.creations[databaseName]
+		if !inFlight {
+			creation = &poolCreation{done: make(chan struct{})}
+			p.creations[databaseName] = creation
+			p.mu.Unlock()
+			return p.runCreation(ctx, databaseName, creation)
+		}
+		p.mu.Unlock()
+
+		// Wait for the creation in flight.
+		select {
+		case <-creation.done:
+		case <-ctx.Done():
+			return nil, false, fmt.Errorf("failed to create connection pool: %w", ctx.Err())
+		}
+		if creation.cancelled {
+			// Retry with our own context.
+			continue
+		}
+		if creation.err != nil {
+			return nil, false, creation.err
+		}
+		creation.entry.touch(p.clock.Now())
+		creation.entry.reuseCount.Add(1)
+		return creation.entry, false, nil
+	}
+}
+
+// poolCreation is a pool creation in flight, shared by concurrent
+// callers for the same database.
+//
+// The result fields are set before done is closed.
+type poolCreation struct {
+	done  chan struct{}
+	entry *poolEntry
+	err   error
+
+	// cancelled reports whether the creation failed because the context
+	// of the caller running it was done.
+	cancelled bool
+	// orphaned is set, under the provider's lock, if the provider
+	// has been closed while the creation was in flight.
+	orphaned bool
+}
+
+// runCreation creates the pool for the database outside the provider's
+// lock, caches it and publishes the result to the callers waiting
+// on the creation. It reports whether the returned pool is the one
+// it created.
+func (p *ConnectionProvider) runCreation(ctx context.Context, databaseName string, creation *poolCreation) (_ *poolEntry, created bool, _ error) {
+	entry, err := p.createEntry(ctx, databaseName)
+	if err == nil && p.validateServerLimits {
+		err = p.loadServerMaxConns(ctx, entry.pool)
+	}
+
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	delete(p.creations, databaseName)
+	switch {
+	case err != nil:
+		creation.cancelled = ctx.Err() != nil
+	case p.draining:
+		err = ErrProviderDraining
+	case creation.orphaned:
+		err = fmt.Errorf("failed to create connection pool: %w", ErrPoolAlreadyClosed)
+	case p.pools[databaseName] != nil:
+		// A pool registered via RegisterPoolReplace in the meantime
+		// takes precedence over the new one.
+		creation.entry = p.pools[databaseName]
+	default:
+		if err = p.checkServerLimits(databaseName, entry.pool); err == nil {
+			creation.entry = entry
+			p.pools[databaseName] = entry
+			p.reapWhenIdle(databaseName, entry)
+		}
+	}
+	creation.err = err
+	p.mu.Unlock()
+	close(creation.done)
+
+	created = err == nil && creation.entry == entry
+	if !created && entry != nil {
+		entry.close()
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return creation.entry, created, nil
+}
+
+// createEntry creates a new, verified pool for the database
+// without caching it, and returns it as a pool entry.
+//
+// The connections of the pool are tracked if WithHardClose,
+// WithCancelInFlightOnClose or WithCloseTimeout has been used.
+func (p *ConnectionProvider) createEntry(ctx context.Context, databaseName string) (*poolEntry, error) {
+	if p.isSharedMaintenance(databaseName) {
+		entry := p.newEntry(p.sharedMaintenancePool)
+		entry.shared = true
+		entry.external = true
+		return entry, nil
+	}
+
+	var conns *connTracker
+	if p.hardClose || p.cancelInFlightOnClose || p.closeTimeout > 0 {
+		conns = &connTracker{}
+	}
+	var info ConnectInfo
+	pool, err := p.createPool(ctx, databaseName, conns, &info)
+	if err != nil {
+		return nil, err
+	}
+	entry := p.newEntry(pool)
+	entry.conns = conns
+	entry.hardClose = p.hardClose
+	entry.connectInfo = info
+	return entry, nil
+}
+
+// isSharedMaintenance reports whether the database is the maintenance
+// database and its pool is shared via WithSharedMaintenancePool.
+func (p *ConnectionProvider) isSharedMaintenance(databaseName string) bool {
+	return databaseName == p.maintenanceDatabase && p.sharedMaintenancePool != nil
+}
+
+// createPool creates a new, verified pool for the database
+// without caching it.
+//
+// New connections are added to conns, if not nil,
+// and the time spent on each step is added to info.
+//
+// Failed attempts are retried according to WithConnectRetry,
+// and a missing database is created if WithAutoCreateDatabase has been used.
+// A pool is only returned once it has passed the health check,
+// so half-initialized pools never escape this function.
+func (p *ConnectionProvider) createPool(ctx context.Context, databaseName string, conns *connTracker, info *ConnectInfo) (*pgxpool.Pool, error) {
+	start := time.Now()
+	config, err := p.parseConfig(databaseName)
+	info.ParseDuration += time.Since(start)
+	if err != nil {
+		return nil, err
+	}
+	if conns != nil {
+		config.AfterConnect = chainAfterConnect(config.AfterConnect, conns.track)
+	}
+
+	if databaseName == p.maintenanceDatabase && p.maintenanceContextFunc != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = p.maintenanceContextFunc(ctx)
+		defer cancel()
+	}
+
+	pool, err := p.connectWithRetry(ctx, databaseName, config, info)
+	if err != nil && p.autoCreateFrom != "" && isUndefinedDatabase(err) {
+		if createErr := p.createDatabase(ctx, databaseName); createErr != nil {
+			return nil, errors.Join(err, createErr)
+		}
+		pool, err = p.connectWithRetry(ctx, databaseName, config, info)
+	}
+	return pool, err
+}
+
+// connectWithRetry connects a verified pool using the parsed config,
+// retrying failed attempts according to WithConnectRetry.
+func (p *ConnectionProvider) connectWithRetry(ctx context.Context, databaseName string, config *pgxpool.Config, info *ConnectInfo) (*pgxpool.Pool, error) {
+	for attempt := 1; ; attempt++ {
+		pool, retryable, err := p.connectPool(ctx, databaseName, config, info)
+		if err == nil {
+			return pool, nil
+		}
+		if !retryable || attempt >= p.connectAttempts {
+			return nil, err
+		}
+		if sleepErr := sleepContext(ctx, p.connectBackoff); sleepErr != nil {
+			return nil, errors.Join(err, sleepErr)
+		}
+	}
+}
+
+// createDatabase creates the database through a one-off connection
+// to the database set via WithAutoCreateDatabase.
+//
+// A database created concurrently by someone else is not an error.
+func (p *ConnectionProvider) createDatabase(ctx context.Context, databaseName string) error {
+	config, err := p.parseConfig(p.autoCreateFrom)
+	if err != nil {
+		return err
+	}
+	conn, err := pgx.ConnectConfig(ctx, config.ConnConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to maintenance database: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	_, err = conn.Exec(ctx, "CREATE DATABASE "+QuoteIdentifier(databaseName))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == duplicateDatabaseCode {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create database %q: %w", databaseName, err)
+	}
+	return nil
+}
+
+// isUndefinedDatabase reports whether err is the server rejecting
+// a connection because the database does not exist.
+func isUndefinedDatabase(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == undefinedDatabaseCode
+}
 
-	// Double-check after acquiring write lock.
-	if pool, exists := p.pools[databaseName]; exists {
-		return &DatabaseConnection{Pool: pool, provider: p, dbName: databaseName}, nil
+// parseConfig builds the pool configuration for the database
+// from its connection string and the provider's options.
+func (p *ConnectionProvider) parseConfig(databaseName string) (*pgxpool.Config, error) {
+	if p.connectionStringFunc == nil {
+		return nil, ErrNilConnectionStringFunc
+	}
+	if err := p.checkGSSEncMode(); err != nil {
+		return nil, p.wrapError(OpParse, err)
 	}
 
 	// Parse connection string first.
-	connString := p.connectionStringFunc(databaseName)
+	connString, err := p.connectionString(databaseName)
+	if err != nil {
+		return nil, p.wrapError(OpParse, err)
+	}
 	config, err := pgxpool.ParseConfig(connString)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse connection string: %w", err)
+		return nil, p.wrapError(OpParse, err)
 	}
 
-	if err := p.applyPoolConfig(config); err != nil {
+	if p.strictPoolConfig {
+		if err := p.checkPoolConfigConflicts(connString); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.applyPoolConfig(config, databaseName); err != nil {
 		return nil, fmt.Errorf("failed to apply pool config: %w", err)
 	}
+	if p.poolConfigFunc != nil {
+		p.poolConfigFunc(databaseName, config)
+		if config.MaxConns < 1 {
+			// Prevent pgx/puddle panic for invalid max pool size.
+			return nil, fmt.Errorf("failed to apply pool config: MaxConns must be >= 1, got %d", config.MaxConns)
+		}
+	}
+	if err := p.checkAllowedHosts(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// checkGSSEncMode validates the mode set via WithGSSEncMode.
+func (p *ConnectionProvider) checkGSSEncMode() error {
+	switch p.gssEncMode {
+	case "", "disable", "prefer":
+		// pgx never negotiates GSS encryption, so these are satisfied as is.
+		return nil
+	case "require":
+		return fmt.Errorf("%w: gssencmode %q", ErrGSSEncryptionUnsupported, p.gssEncMode)
+	default:
+		return fmt.Errorf("invalid gssencmode %q", p.gssEncMode)
+	}
+}
+
+// connectionString returns the connection string for the database
+// with the transport settings of the provider's options applied.
+func (p *ConnectionProvider) connectionString(databaseName string) (string, error) {
+	connString := p.connectionStringFunc(databaseName)
+	if databaseName == p.maintenanceDatabase && p.maintenanceConnectionStringFunc != nil {
+		connString = p.maintenanceConnectionStringFunc()
+	}
+
+	if p.sslMode == "" {
+		return connString, nil
+	}
+	switch p.sslMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		return "", fmt.Errorf("invalid sslmode %q", p.sslMode)
+	}
+	return setConnStringParam(connString, "sslmode", p.sslMode), nil
+}
 
+// connectPool makes a single attempt to create and verify a pool,
+// adding the time spent dialing and pinging to info.
+// It reports whether a failure may be retried.
+func (p *ConnectionProvider) connectPool(ctx context.Context, databaseName string, config *pgxpool.Config, info *ConnectInfo) (_ *pgxpool.Pool, retryable bool, _ error) {
+	start := time.Now()
 	pool, err := pgxpool.ConnectConfig(ctx, config)
+	info.DialDuration += time.Since(start)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+		// Only transient failures, e.g. a server still starting up, are
+		// retried; authentication or missing database errors are not.
+		return nil, IsConnectionError(err), p.wrapError(OpConnect, err)
 	}
 
 	// Test the connection.
-	if err := pool.Ping(ctx); err != nil {
+	start = time.Now()
+	err = p.checkReadiness(ctx, databaseName, pool)
+	info.PingDuration += time.Since(start)
+	if err != nil {
 		pool.Close()
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+		return nil, p.pingFailurePolicy == PingFailureRetry, p.wrapError(OpPing, err)
 	}
+	return pool, false, nil
+}
 
-	p.pools[databaseName] = pool
-	return &DatabaseConnection{
-		Pool:     pool,
-		provider: p,
-		dbName:   databaseName,
-	}, nil
+// checkReadiness verifies a newly created pool before it is cached:
+// with the readiness probe set via WithReadinessProbe if there is one,
+// or with a single health check otherwise.
+func (p *ConnectionProvider) checkReadiness(ctx context.Context, databaseName string, pool *pgxpool.Pool) error {
+	probe := p.readinessProbe
+	if probe == nil {
+		return p.ping(ctx, databaseName, pool)
+	}
+
+	query := &probe.query
+	if probe.query == "" {
+		query = p.pingQuery
+	}
+	for attempt := 1; ; attempt++ {
+		err := p.runPing(ctx, pool, query)
+		if err == nil {
+			return nil
+		}
+		if attempt >= probe.attempts {
+			err = fmt.Errorf("readiness probe failed after %d attempts: %w", attempt, err)
+			p.reportError(databaseName, fmt.Errorf("ping: %w", err))
+			return err
+		}
+		if sleepErr := sleepContext(ctx, probe.interval); sleepErr != nil {
+			return errors.Join(err, sleepErr)
+		}
+	}
+}
+
+// ping runs the health check against the pool for the database,
+// reporting failures to the error channel.
+func (p *ConnectionProvider) ping(ctx context.Context, databaseName string, pool *pgxpool.Pool) error {
+	if err := p.runPing(ctx, pool, p.pingQuery); err != nil {
+		p.reportError(databaseName, fmt.Errorf("ping: %w", err))
+		return err
+	}
+	return nil
+}
+
+// runPing performs a single health check against the pool,
+// running the query if not nil or pinging the server otherwise.
+func (p *ConnectionProvider) runPing(ctx context.Context, pool *pgxpool.Pool, query *string) error {
+	if p.pingHook != nil {
+		if err := p.pingHook(ctx); err != nil {
+			return err
+		}
+	}
+	if query == nil {
+		return pool.Ping(ctx)
+	}
+
+	if strings.TrimSpace(*query) == "" {
+		return errors.New("ping query must not be empty")
+	}
+	_, err := pool.Exec(ctx, *query)
+	return err
+}
+
+// wrapError annotates a parse, connect or ping failure,
+// using the function set via WithErrorWrapper if there is one.
+func (p *ConnectionProvider) wrapError(op string, err error) error {
+	if p.errorWrapper != nil {
+		return p.errorWrapper(op, err)
+	}
+
+	switch op {
+	case OpParse:
+		return fmt.Errorf("failed to parse connection string: %w", err)
+	case OpConnect:
+		return fmt.Errorf("failed to create connection pool: %w", err)
+	case OpPing:
+		return fmt.Errorf("failed to ping database: %w", err)
+	default:
+		return fmt.Errorf("%s failed: %w", op, err)
+	}
+}
+
+// sleepContext waits for the given duration or until ctx is done,
+// whichever happens first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// PinnedConn is a single database connection held
+// for the whole duration of a WithSameConn callback.
+type PinnedConn interface {
+	// ExecContext executes a query on the pinned connection.
+	ExecContext(ctx context.Context, query string, args ...any) (any, error)
+	// QueryRowContext executes a query that is expected to return
+	// a single row on the pinned connection.
+	QueryRowContext(ctx context.Context, query string, args ...any) pgdbtemplate.Row
+}
+
+// WithSameConn acquires a single connection to the database and passes it
+// to fn, so that every statement in fn runs on the same backend.
+//
+// This is needed for session-scoped state such as temporary tables
+// or advisory locks. The connection is released when fn returns,
+// even if fn panics. The pool is created if it does not exist yet.
+func (p *ConnectionProvider) WithSameConn(ctx context.Context, databaseName string, fn func(ctx context.Context, conn PinnedConn) error) error {
+	entry, err := p.getOrCreateEntry(ctx, databaseName)
+	if err != nil {
+		return err
+	}
+
+	conn, err := p.acquire(ctx, databaseName, entry)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	return fn(ctx, &pinnedConn{conn: conn})
+}
+
+// pinnedConn implements PinnedConn on top of an acquired pool connection.
+type pinnedConn struct {
+	conn *pgxpool.Conn
+}
+
+// ExecContext implements PinnedConn.ExecContext.
+func (c *pinnedConn) ExecContext(ctx context.Context, query string, args ...any) (any, error) {
+	return c.conn.Exec(ctx, query, args...)
+}
+
+// QueryRowContext implements PinnedConn.QueryRowContext.
+func (c *pinnedConn) QueryRowContext(ctx context.Context, query string, args ...any) pgdbtemplate.Row {
+	return c.conn.QueryRow(ctx, query, args...)
+}
+
+// WithConnection connects to the database, passes the connection to fn
+// and closes it when fn returns, even if fn panics.
+//
+// fn's error is returned; if fn succeeds, the error of closing the
+// connection is returned instead. Like DatabaseConnection.Close, closing
+// closes the provider's pool for the database, so WithConnection suits
+// one-off work rather than databases used through other handles.
+func (p *ConnectionProvider) WithConnection(ctx context.Context, databaseName string, fn func(conn *DatabaseConnection) error) (err error) {
+	conn, err := p.Connect(ctx, databaseName)
+	if err != nil {
+		return err
+	}
+	pgxConn := conn.(*DatabaseConnection)
+	defer func() {
+		if closeErr := pgxConn.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	return fn(pgxConn)
+}
+
+// ValidateConnectionString checks that the connection string produced
+// for the given database name can be parsed, without dialing the server.
+//
+// This is useful to catch typos in connectionStringFunc early,
+// before a test suite starts creating databases.
+func (p *ConnectionProvider) ValidateConnectionString(databaseName string) error {
+	if p.connectionStringFunc == nil {
+		return ErrNilConnectionStringFunc
+	}
+
+	connString, err := p.connectionString(databaseName)
+	if err != nil {
+		return p.wrapError(OpParse, err)
+	}
+	if _, err := pgxpool.ParseConfig(connString); err != nil {
+		return p.wrapError(OpParse, err)
+	}
+	return nil
 }
 
 // applyPoolConfig merges user-provided pool options into a parsed config,
@@ -92,7 +899,7 @@ func (p *ConnectionProvider) Connect(ctx context.Context, databaseName string) (
 // ConnConfig is intentionally not copied from p.poolConfig to preserve
 // Connect(databaseName) behavior that derives the target database from the
 // parsed connection string for each call.
-func (p *ConnectionProvider) applyPoolConfig(config *pgxpool.Config) error {
+func (p *ConnectionProvider) applyPoolConfig(config *pgxpool.Config, databaseName string) error {
 	if p.poolConfig.HealthCheckPeriod != 0 {
 		config.HealthCheckPeriod = p.poolConfig.HealthCheckPeriod
 	}
@@ -115,40 +922,589 @@ func (p *ConnectionProvider) applyPoolConfig(config *pgxpool.Config) error {
 	if p.poolConfig.BeforeConnect != nil {
 		config.BeforeConnect = p.poolConfig.BeforeConnect
 	}
-	if p.poolConfig.AfterConnect != nil {
-		config.AfterConnect = p.poolConfig.AfterConnect
+	if afterConnect := p.afterConnect(databaseName); afterConnect != nil {
+		config.AfterConnect = afterConnect
 	}
-	if p.poolConfig.BeforeAcquire != nil {
-		config.BeforeAcquire = p.poolConfig.BeforeAcquire
+	if beforeAcquire := p.beforeAcquire(databaseName); beforeAcquire != nil {
+		config.BeforeAcquire = beforeAcquire
 	}
-	if p.poolConfig.AfterRelease != nil {
-		config.AfterRelease = p.poolConfig.AfterRelease
+	if afterRelease := p.afterRelease(); afterRelease != nil {
+		config.AfterRelease = afterRelease
 	}
 	// LazyConnect: bool, false is both zero-value and the pgx default; assign unconditionally.
 	config.LazyConnect = p.poolConfig.LazyConnect
 
+	if p.preferSimpleProtocol {
+		config.ConnConfig.PreferSimpleProtocol = true
+	}
+
+	if p.statementTimeout != nil && *p.statementTimeout < 0 {
+		return fmt.Errorf("statement timeout must be >= 0, got %s", *p.statementTimeout)
+	}
+	if p.lockTimeout != nil && *p.lockTimeout < 0 {
+		return fmt.Errorf("lock timeout must be >= 0, got %s", *p.lockTimeout)
+	}
+	if p.isolationLevel != "" && !isIsolationLevel(p.isolationLevel) {
+		return fmt.Errorf("unknown isolation level %q", p.isolationLevel)
+	}
+
+	if len(p.searchPath) > 0 {
+		searchPath, err := formatSearchPath(p.searchPath)
+		if err != nil {
+			return err
+		}
+		config.ConnConfig.RuntimeParams["search_path"] = searchPath
+	}
+
+	return nil
+}
+
+// schemaNamePattern matches schema names accepted by WithSearchPath.
+var schemaNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*$`)
+
+// formatSearchPath validates the schema names and renders them
+// as a search_path value, quoting each name to preserve its case.
+func formatSearchPath(schemas []string) (string, error) {
+	quoted := make([]string, 0, len(schemas))
+	for _, schema := range schemas {
+		if schema != "$user" && !schemaNamePattern.MatchString(schema) {
+			return "", fmt.Errorf("invalid schema name %q in search path", schema)
+		}
+		quoted = append(quoted, QuoteIdentifier(schema))
+	}
+	return strings.Join(quoted, ", "), nil
+}
+
+// checkPoolConfigConflicts reports pool parameters that are set
+// both in the connection string and via connection options.
+func (p *ConnectionProvider) checkPoolConfigConflicts(connString string) error {
+	// pgxpool.ParseConfig consumes the pool_* parameters,
+	// so parse with pgx to see them as raw runtime parameters.
+	connConfig, err := pgx.ParseConfig(connString)
+	if err != nil {
+		return p.wrapError(OpParse, err)
+	}
+
+	params := []struct {
+		name      string
+		optionSet bool
+	}{
+		{"pool_max_conns", p.poolConfig.MaxConns != 0},
+		{"pool_min_conns", p.poolConfig.MinConns != 0},
+		{"pool_max_conn_lifetime", p.poolConfig.MaxConnLifetime != 0},
+		{"pool_max_conn_idle_time", p.poolConfig.MaxConnIdleTime != 0},
+		{"pool_health_check_period", p.poolConfig.HealthCheckPeriod != 0},
+	}
+
+	var conflicts []string
+	for _, param := range params {
+		if _, inConnString := connConfig.RuntimeParams[param.name]; inConnString && param.optionSet {
+			conflicts = append(conflicts, param.name)
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%w: %s set both in connection string and options",
+			ErrPoolConfigConflict, strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// afterConnect returns the AfterConnect hook for pools of the database:
+// the user-provided hook, retried if WithAfterConnectRetry has been used,
+// followed by the session setup of the provider,
+// and reported to the error channel when it fails.
+func (p *ConnectionProvider) afterConnect(databaseName string) func(context.Context, *pgx.Conn) error {
+	afterConnect := p.poolConfig.AfterConnect
+	if afterConnect != nil && p.afterConnectAttempts >= 2 {
+		afterConnect = retryAfterConnect(afterConnect, p.afterConnectAttempts, p.afterConnectBackoff)
+	}
+	if p.connInfoSetup != nil {
+		// Types are registered before the AfterConnect hook may use them.
+		setup := setupConnInfo(p.connInfoSetup)
+		if afterConnect != nil {
+			setup = chainAfterConnect(setup, afterConnect)
+		}
+		afterConnect = setup
+	}
+	if p.readOnly {
+		afterConnect = chainAfterConnect(afterConnect, setReadOnly)
+	}
+	if p.statementTimeout != nil {
+		afterConnect = chainAfterConnect(afterConnect, setTimeout("statement_timeout", *p.statementTimeout))
+	}
+	if p.lockTimeout != nil {
+		afterConnect = chainAfterConnect(afterConnect, setTimeout("lock_timeout", *p.lockTimeout))
+	}
+	if p.isolationLevel != "" {
+		afterConnect = chainAfterConnect(afterConnect, setIsolationLevel(p.isolationLevel))
+	}
+	if afterConnect == nil || p.errorChannel == nil {
+		return afterConnect
+	}
+
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		err := afterConnect(ctx, conn)
+		if err != nil {
+			p.reportError(databaseName, fmt.Errorf("after connect: %w", err))
+		}
+		return err
+	}
+}
+
+// chainAfterConnect returns an AfterConnect hook running first, if not nil,
+// and then next.
+func chainAfterConnect(first, next func(context.Context, *pgx.Conn) error) func(context.Context, *pgx.Conn) error {
+	if first == nil {
+		return next
+	}
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		if err := first(ctx, conn); err != nil {
+			return err
+		}
+		return next(ctx, conn)
+	}
+}
+
+// setTimeout returns an AfterConnect hook setting a timeout parameter
+// of the session, in milliseconds.
+func setTimeout(param string, timeout time.Duration) func(context.Context, *pgx.Conn) error {
+	ms := timeout.Milliseconds()
+	if timeout > 0 && ms == 0 {
+		// Zero would disable the timeout altogether.
+		ms = 1
+	}
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		if _, err := conn.Exec(ctx, fmt.Sprintf("SET %s = %d", param, ms)); err != nil {
+			return fmt.Errorf("failed to set %s: %w", param, err)
+		}
+		return nil
+	}
+}
+
+// setupConnInfo returns an AfterConnect hook applying fn
+// to the type information of the connection.
+func setupConnInfo(fn func(*pgtype.ConnInfo)) func(context.Context, *pgx.Conn) error {
+	return func(_ context.Context, conn *pgx.Conn) error {
+		fn(conn.ConnInfo())
+		return nil
+	}
+}
+
+// isIsolationLevel reports whether level is a transaction isolation level
+// known to PostgreSQL.
+func isIsolationLevel(level string) bool {
+	switch pgx.TxIsoLevel(strings.ToLower(level)) {
+	case pgx.Serializable, pgx.RepeatableRead, pgx.ReadCommitted, pgx.ReadUncommitted:
+		return true
+	default:
+		return false
+	}
+}
+
+// setIsolationLevel returns an AfterConnect hook setting the default
+// transaction isolation level of the session.
+func setIsolationLevel(level string) func(context.Context, *pgx.Conn) error {
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		if _, err := conn.Exec(ctx, "SET default_transaction_isolation = "+QuoteLiteral(strings.ToLower(level))); err != nil {
+			return fmt.Errorf("failed to set default_transaction_isolation: %w", err)
+		}
+		return nil
+	}
+}
+
+// retryAfterConnect wraps an AfterConnect hook so that it is attempted
+// up to attempts times, waiting backoff between attempts.
+func retryAfterConnect(afterConnect func(context.Context, *pgx.Conn) error, attempts int, backoff time.Duration) func(context.Context, *pgx.Conn) error {
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		for attempt := 1; ; attempt++ {
+			err := afterConnect(ctx, conn)
+			if err == nil {
+				return nil
+			}
+			if attempt == attempts {
+				return fmt.Errorf("after connect failed after %d attempts: %w", attempts, err)
+			}
+
+			// Wait before the next attempt unless the connection is being abandoned.
+			if sleepErr := sleepContext(ctx, backoff); sleepErr != nil {
+				return errors.Join(err, sleepErr)
+			}
+		}
+	}
+}
+
+// beforeAcquire returns the BeforeAcquire hook for pools of the database:
+// the user-provided hook, reported to the error channel when it rejects
+// a connection, followed by the statement set via WithOnAcquireSQL.
+func (p *ConnectionProvider) beforeAcquire(databaseName string) func(context.Context, *pgx.Conn) bool {
+	beforeAcquire := p.poolConfig.BeforeAcquire
+	if beforeAcquire != nil && p.errorChannel != nil {
+		hook := beforeAcquire
+		beforeAcquire = func(ctx context.Context, conn *pgx.Conn) bool {
+			if hook(ctx, conn) {
+				return true
+			}
+			p.reportError(databaseName, errors.New("before acquire rejected the connection"))
+			return false
+		}
+	}
+	if p.onAcquireSQL == "" {
+		return beforeAcquire
+	}
+
+	return func(ctx context.Context, conn *pgx.Conn) bool {
+		if beforeAcquire != nil && !beforeAcquire(ctx, conn) {
+			return false
+		}
+		if _, err := conn.Exec(ctx, p.onAcquireSQL); err != nil {
+			p.reportError(databaseName, fmt.Errorf("on acquire SQL: %w", err))
+			return false
+		}
+		return true
+	}
+}
+
+// reportError sends a pool error to the error channel, if there is one.
+//
+// The send never blocks: the error is dropped if the channel is full.
+func (p *ConnectionProvider) reportError(databaseName string, err error) {
+	if p.errorChannel == nil {
+		return
+	}
+	select {
+	case p.errorChannel <- PoolError{DatabaseName: databaseName, Err: err}:
+	default:
+	}
+}
+
+// RefreshIfStale checks the cached pool for the database and,
+// if it no longer passes the health check, transparently replaces it
+// with a freshly created pool.
+//
+// This helps when a database is reset out-of-band, e.g. while iterating
+// on migrations. DatabaseConnection handles obtained before the refresh
+// keep pointing to the stale pool, so callers should Connect again.
+// ErrPoolNotFound is returned if the provider has no pool for the database.
+func (p *ConnectionProvider) RefreshIfStale(ctx context.Context, databaseName string) error {
+	entry, err := p.lookupEntry(databaseName)
+	if err != nil {
+		return err
+	}
+	if err := p.ping(ctx, databaseName, entry.pool); err == nil {
+		return nil
+	}
+
+	// Create the new pool without holding the lock, like Connect.
+	fresh, err := p.createEntry(ctx, databaseName)
+	if err != nil {
+		return fmt.Errorf("failed to refresh pool: %w", err)
+	}
+
+	p.mu.Lock()
+	// The pool may have been refreshed or removed concurrently.
+	current, exists := p.pools[databaseName]
+	if !exists || current != entry {
+		p.mu.Unlock()
+		fresh.close()
+		if !exists {
+			return fmt.Errorf("%w: %q", ErrPoolNotFound, databaseName)
+		}
+		return nil
+	}
+	p.pools[databaseName] = fresh
+	p.reapWhenIdle(databaseName, fresh)
+	p.closeReplacedEntry(databaseName, entry)
+	p.mu.Unlock()
 	return nil
 }
 
+// closeReplacedEntry closes an entry no longer cached for the database
+// in the background, since closing waits for checked-out connections.
+// Until it is closed, the entry is kept in p.replaced, so that Drain
+// waits for its connections in use and Close force-closes it if needed.
+//
+// The caller must hold p.mu.
+func (p *ConnectionProvider) closeReplacedEntry(databaseName string, entry *poolEntry) {
+	entry.retire()
+	p.replaced[entry] = databaseName
+	go func() {
+		entry.close()
+
+		p.mu.Lock()
+		delete(p.replaced, entry)
+		p.mu.Unlock()
+	}()
+}
+
+// Ping runs the health check against the cached pool for the database.
+//
+// Unlike Connect, Ping never creates a pool: ErrPoolNotFound is returned
+// if the provider has no pool for the database.
+func (p *ConnectionProvider) Ping(ctx context.Context, databaseName string) error {
+	entry, err := p.lookupEntry(databaseName)
+	if err != nil {
+		return err
+	}
+	return p.ping(ctx, databaseName, entry.pool)
+}
+
+// Healthy reports whether the cached pool for the database
+// passes a health check bounded to a few seconds.
+//
+// It is a yes/no convenience over Ping for readiness checks and test skips.
+// Healthy never creates a pool and returns false if none exists.
+func (p *ConnectionProvider) Healthy(ctx context.Context, databaseName string) bool {
+	ctx, cancel := context.WithTimeout(ctx, healthyTimeout)
+	defer cancel()
+
+	return p.Ping(ctx, databaseName) == nil
+}
+
+// lookupEntry returns the cached pool entry for the database
+// without creating one.
+func (p *ConnectionProvider) lookupEntry(databaseName string) (*poolEntry, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	entry, exists := p.pools[databaseName]
+	if !exists {
+		return nil, fmt.Errorf("%w: %q", ErrPoolNotFound, databaseName)
+	}
+	return entry, nil
+}
+
+// NumPools returns the number of pools currently cached by the provider.
+func (p *ConnectionProvider) NumPools() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return len(p.pools)
+}
+
+// LastUsed returns when the pool for the database was last used,
+// either by Connect or by a query through a DatabaseConnection.
+//
+// The second return value is false if the provider has no pool
+// for the database.
+func (p *ConnectionProvider) LastUsed(databaseName string) (time.Time, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	entry, exists := p.pools[databaseName]
+	if !exists {
+		return time.Time{}, false
+	}
+	return entry.lastUsedAt(), true
+}
+
 // GetNoRowsSentinel implements pgdbtemplate.ConnectionProvider.GetNoRowsSentinel.
 func (*ConnectionProvider) GetNoRowsSentinel() error {
 	return pgx.ErrNoRows
 }
 
+// AsPgxProvider returns the pgx provider behind the core interface,
+// so that code holding a pgdbtemplate.ConnectionProvider can use the
+// pgx-specific features, e.g. Stats or Ping. It reports false if p is
+// not a *ConnectionProvider, including when p is nil.
+func AsPgxProvider(p pgdbtemplate.ConnectionProvider) (*ConnectionProvider, bool) {
+	provider, ok := p.(*ConnectionProvider)
+	if !ok || provider == nil {
+		return nil, false
+	}
+	return provider, true
+}
+
 // Close closes all connection pools managed by this provider.
 //
 // This should be called when the provider is no longer needed, typically
 // in cleanup code or deferred calls. Note that individual DatabaseConnection.Close()
 // calls will also close their respective pools, so this is a safety net for
 // any remaining pools (e.g., the template database pool).
-func (p *ConnectionProvider) Close() {
+//
+// Closing a pool waits for its connections in use to be released.
+// If WithCloseTimeout has been used, pools still closing after the timeout
+// are force-closed and reported with an ErrCloseTimeout each; without it,
+// Close always returns nil. Force-closing a pool closes the network
+// connections of all of its connections, so the server ends their sessions,
+// including those of connections that were never released. Such connections
+// are still returned to the pool once their holders release them.
+// If WithCancelInFlightOnClose has been used, the queries running
+// on connections in use are canceled first.
+func (p *ConnectionProvider) Close() error {
+	p.metrics.close()
+
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	entries, _ := p.removeEntries(func(string) bool { return true })
+	p.mu.Unlock()
 
-	for _, pool := range p.pools {
-		pool.Close()
+	// Closing waits for checked-out connections, so do it outside the lock.
+	return p.closeEntries(entries)
+}
+
+// removeEntries removes the cached pools and the pools replaced by
+// ReconfigureDatabase still open for the databases matching the predicate,
+// returning them with their database names, and how many of them were
+// cached. Pool creations in flight for these databases are orphaned,
+// so that their pools are closed instead of being cached.
+//
+// The caller must hold p.mu.
+func (p *ConnectionProvider) removeEntries(match func(databaseName string) bool) (_ map[*poolEntry]string, cached int) {
+	entries := make(map[*poolEntry]string)
+	for databaseName, entry := range p.pools {
+		if match(databaseName) {
+			entries[entry] = databaseName
+			delete(p.pools, databaseName)
+			cached++
+		}
+	}
+	for entry, databaseName := range p.replaced {
+		if match(databaseName) {
+			entries[entry] = databaseName
+			delete(p.replaced, entry)
+		}
 	}
-	p.pools = make(map[string]*pgxpool.Pool)
+	for databaseName, creation := range p.creations {
+		if match(databaseName) {
+			creation.orphaned = true
+		}
+	}
+	return entries, cached
+}
+
+// closeEntries closes the pools, given with their database names,
+// which must no longer be cached: their in-flight queries are canceled
+// if WithCancelInFlightOnClose has been used, and closing them is bounded
+// by the timeout set via WithCloseTimeout, if any.
+func (p *ConnectionProvider) closeEntries(entries map[*poolEntry]string) error {
+	p.cancelInFlight(entries)
+
+	if p.closeTimeout <= 0 {
+		for entry := range entries {
+			entry.close()
+		}
+		return nil
+	}
+	return closePoolsWithTimeout(entries, p.closeTimeout)
+}
+
+// ClosePoolsFunc closes and removes every pool whose database name
+// matches the predicate, returning how many pools were closed.
+//
+// For example, strings.HasPrefix can be used to close the pools
+// of all test databases sharing a prefix without enumerating them.
+// DatabaseConnection handles of closed pools must not be used afterwards.
+//
+// The pools are closed like by Close, including pools replaced by
+// ReconfigureDatabase still open for these databases; pools still closing
+// after the timeout set via WithCloseTimeout are force-closed. Pool
+// creations in flight for these databases fail instead of caching their
+// pools after the sweep.
+func (p *ConnectionProvider) ClosePoolsFunc(predicate func(databaseName string) bool) int {
+	p.mu.Lock()
+	entries, closed := p.removeEntries(predicate)
+	p.mu.Unlock()
+
+	// Closing waits for checked-out connections, so do it outside the lock.
+	// Pools timing out are force-closed, so they are closed all the same.
+	_ = p.closeEntries(entries)
+	return closed
+}
+
+// closePoolsWithTimeout closes the pools concurrently. Pools still closing
+// after the timeout are force-closed and reported with an ErrCloseTimeout.
+//
+// The pools are given with their database names.
+func closePoolsWithTimeout(entries map[*poolEntry]string, timeout time.Duration) error {
+	closed := make(chan *poolEntry, len(entries))
+	pending := make(map[*poolEntry]struct{}, len(entries))
+	for entry := range entries {
+		pending[entry] = struct{}{}
+		go func(entry *poolEntry) {
+			entry.close()
+			closed <- entry
+		}(entry)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for len(pending) > 0 {
+		select {
+		case entry := <-closed:
+			delete(pending, entry)
+		case <-timer.C:
+			names := make([]string, 0, len(pending))
+			for entry := range pending {
+				entry.forceClose()
+				names = append(names, entries[entry])
+			}
+			sort.Strings(names)
+
+			errs := make([]error, 0, len(names))
+			for _, databaseName := range names {
+				errs = append(errs, fmt.Errorf("%w: database %q after %s, force-closed", ErrCloseTimeout, databaseName, timeout))
+			}
+			return errors.Join(errs...)
+		}
+	}
+	return nil
+}
+
+// Drain gracefully shuts the provider down.
+//
+// From the moment Drain is called, Connect returns ErrProviderDraining,
+// while DatabaseConnection handles obtained earlier keep working.
+// Once no pool has connections in use, including the pools replaced by
+// RefreshIfStale, RegisterPoolReplace or ReconfigureDatabase that are
+// still open, all pools are closed and Drain returns the result of Close. If ctx is done first, the pools are removed and closed
+// in the background as their connections are released,
+// and the context error is returned.
+//
+// Unlike Close, Drain is meant for long-lived services that need an orderly
+// shutdown. A drained provider does not accept new connections again.
+func (p *ConnectionProvider) Drain(ctx context.Context) error {
+	p.mu.Lock()
+	p.draining = true
+	p.mu.Unlock()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for !p.idle() {
+		select {
+		case <-ctx.Done():
+			p.mu.Lock()
+			entries, _ := p.removeEntries(func(string) bool { return true })
+			p.mu.Unlock()
+
+			for entry := range entries {
+				go entry.close()
+			}
+			return fmt.Errorf("failed to drain connection pools: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	return p.Close()
+}
+
+// idle reports whether no pool, including the replaced pools still open,
+// has connections in use.
+func (p *ConnectionProvider) idle() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, entry := range p.pools {
+		if entry.pool.Stat().AcquiredConns() > 0 {
+			return false
+		}
+	}
+	for entry := range p.replaced {
+		if entry.pool.Stat().AcquiredConns() > 0 {
+			return false
+		}
+	}
+	return true
 }
 
 // DatabaseConnection implements pgdbtemplate.DatabaseConnection using pgx.
@@ -156,18 +1512,136 @@ type DatabaseConnection struct {
 	Pool     *pgxpool.Pool
 	provider *ConnectionProvider
 	dbName   string
+	entry    *poolEntry
+	// closed is true once Close has released the handle of a replaced pool.
+	// It is guarded by the provider's mu.
+	closed bool
 }
 
 // ExecContext implements pgdbtemplate.DatabaseConnection.ExecContext.
 func (c *DatabaseConnection) ExecContext(ctx context.Context, query string, args ...any) (any, error) {
-	return c.Pool.Exec(ctx, query, args...)
+	c.touch()
+	c.countExec(ctx)
+	c.logQuery(ctx, "Exec", query, args)
+	return c.runQuery(ctx, QueryExec, query, args)
 }
 
 // QueryRowContext implements pgdbtemplate.DatabaseConnection.QueryRowContext.
 //
 // The returned pgx.Row naturally implements the pgdbtemplate.Row interface.
 func (c *DatabaseConnection) QueryRowContext(ctx context.Context, query string, args ...any) pgdbtemplate.Row {
-	return c.Pool.QueryRow(ctx, query, args...)
+	c.touch()
+	c.countQuery(ctx)
+	c.logQuery(ctx, "QueryRow", query, args)
+	return asRow(c.runQuery(ctx, QueryRow, query, args))
+}
+
+// ExecContextAcquire is like ExecContext, but gives up with ErrAcquireTimeout
+// if no connection can be acquired from the pool within acquireTimeout.
+//
+// The timeout bounds only the acquisition, not the query execution,
+// which distinguishes "couldn't get a connection" from "query ran long".
+func (c *DatabaseConnection) ExecContextAcquire(ctx context.Context, acquireTimeout time.Duration, query string, args ...any) (any, error) {
+	c.touch()
+	c.countExec(ctx)
+	c.logQuery(ctx, "Exec", query, args)
+	if err := c.checkPaused(); err != nil {
+		return nil, err
+	}
+
+	acquireCtx, cancel := context.WithTimeout(ctx, acquireTimeout)
+	conn, err := c.acquire(acquireCtx)
+	cancel()
+	if err != nil {
+		if ctx.Err() == nil && errors.Is(acquireCtx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w after %s: %w", ErrAcquireTimeout, acquireTimeout, err)
+		}
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	return conn.Exec(ctx, query, args...)
+}
+
+// ExecMultiple runs a batch of SQL statements separated by semicolons,
+// e.g. the contents of a raw .sql migration file.
+//
+// The batch takes no arguments, so pgx sends it using the simple protocol,
+// which accepts multiple statements in one query, unlike the extended
+// protocol used for queries with arguments. Without a transaction in the
+// batch itself, the statements run in a single implicit transaction.
+// Like ExecContext, the batch goes through the query middlewares
+// (see WithQueryMiddleware).
+func (c *DatabaseConnection) ExecMultiple(ctx context.Context, sql string) error {
+	c.touch()
+	c.countExec(ctx)
+	c.logQuery(ctx, "Exec", sql, nil)
+
+	if _, err := c.runQuery(ctx, QueryExec, sql, nil); err != nil {
+		return fmt.Errorf("failed to execute statements: %w", err)
+	}
+	return nil
+}
+
+// touch marks the provider's pool entry as used, if there is one.
+func (c *DatabaseConnection) touch() {
+	if c.entry != nil {
+		c.entry.touch(c.provider.clock.Now())
+	}
+}
+
+// logQuery logs a query through the logger of the call's context
+// or, failing that, the provider's logger, if there is one.
+func (c *DatabaseConnection) logQuery(ctx context.Context, msg string, query string, args []any) {
+	if c.provider == nil {
+		return
+	}
+	logger := c.provider.logger
+	if c.provider.contextLoggerFunc != nil {
+		if contextLogger := c.provider.contextLoggerFunc(ctx); contextLogger != nil {
+			logger = contextLogger
+		}
+	}
+	if logger == nil {
+		return
+	}
+
+	logger.Log(ctx, pgx.LogLevelInfo, msg, map[string]any{
+		"database": c.dbName,
+		"sql":      query,
+		"args":     args,
+	})
+}
+
+// countExec counts an exec on the provider's pool entry, if there is one,
+// and in the provider's metrics.
+func (c *DatabaseConnection) countExec(ctx context.Context) {
+	if c.entry != nil {
+		c.entry.execCount.Add(1)
+	}
+	if c.provider != nil {
+		c.provider.metrics.recordQuery(ctx, c.dbName, QueryExec)
+	}
+}
+
+// countQuery counts a query on the provider's pool entry, if there is one,
+// and in the provider's metrics.
+func (c *DatabaseConnection) countQuery(ctx context.Context) {
+	if c.entry != nil {
+		c.entry.queryCount.Add(1)
+	}
+	if c.provider != nil {
+		c.provider.metrics.recordQuery(ctx, c.dbName, QueryRow)
+	}
+}
+
+// acquire acquires a connection from the pool, through the provider
+// if there is one so that the acquisition is measured.
+func (c *DatabaseConnection) acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	if c.provider == nil {
+		return c.Pool.Acquire(ctx)
+	}
+	return c.provider.acquire(ctx, c.dbName, c.entry)
 }
 
 // Close implements pgdbtemplate.DatabaseConnection.Close.
@@ -177,6 +1651,13 @@ func (c *DatabaseConnection) QueryRowContext(ctx context.Context, query string,
 //
 // In the pgdbtemplate usage pattern, each test database has a unique name,
 // so pools are not shared and can be safely closed when the connection closes.
+//
+// ErrPoolAlreadyClosed is returned if the pool is no longer cached by the
+// provider: the handle (or another handle to the same pool) has already
+// been closed, the provider has been closed or the pool has been removed
+// otherwise. A pool created later for the same database is left untouched.
+// Handles of a pool replaced by ReconfigureDatabase leave the new pool
+// untouched as well: the old pool is closed with the last of them.
 func (c *DatabaseConnection) Close() error {
 	if c.provider == nil {
 		// Connection created without provider tracking.
@@ -188,8 +1669,17 @@ func (c *DatabaseConnection) Close() error {
 	c.provider.mu.Lock()
 	defer c.provider.mu.Unlock()
 
+	if c.entry != nil && c.entry.replaced {
+		return c.closeReplaced()
+	}
+
+	entry, exists := c.provider.pools[c.dbName]
+	if !exists || entry.pool != c.Pool {
+		return fmt.Errorf("%w: %q", ErrPoolAlreadyClosed, c.dbName)
+	}
+
 	// Close and remove the pool for this database.
-	c.Pool.Close()
+	entry.close()
 	delete(c.provider.pools, c.dbName)
 	return nil
 }
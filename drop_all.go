@@ -0,0 +1,63 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// CloseAndDropAll tears down every database the provider has a pool for:
+// each pool is closed and removed, and the database is dropped through
+// the maintenance database maintenanceDB, which is itself skipped.
+//
+// Sessions connected to a database, including connections of its pool
+// that were never released and sessions from other providers, are
+// terminated before it is dropped, so that a leaked connection does not
+// hold up the teardown: pools finish closing in the background once
+// their connections are released. Failures do not stop the teardown
+// of the other databases and are returned joined with errors.Join.
+// The pool for maintenanceDB, if any, is left open.
+func (p *ConnectionProvider) CloseAndDropAll(ctx context.Context, maintenanceDB string) error {
+	p.mu.Lock()
+	entries := make(map[string]*poolEntry, len(p.pools))
+	for databaseName, entry := range p.pools {
+		if databaseName == maintenanceDB {
+			continue
+		}
+		entries[databaseName] = entry
+		delete(p.pools, databaseName)
+	}
+	p.mu.Unlock()
+
+	names := make([]string, 0, len(entries))
+	for databaseName, entry := range entries {
+		// Closing waits for checked-out connections, so do not block on it.
+		go entry.close()
+		names = append(names, databaseName)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	maintenance, err := p.getOrCreateEntry(ctx, maintenanceDB)
+	if err != nil {
+		return fmt.Errorf("failed to connect to maintenance database: %w", err)
+	}
+
+	var errs []error
+	for _, databaseName := range names {
+		_, err := maintenance.pool.Exec(ctx,
+			"SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid()",
+			databaseName)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to terminate sessions of database %q: %w", databaseName, err))
+			continue
+		}
+		if _, err := maintenance.pool.Exec(ctx, "DROP DATABASE IF EXISTS "+QuoteIdentifier(databaseName)); err != nil {
+			errs = append(errs, fmt.Errorf("failed to drop database %q: %w", databaseName, err))
+		}
+	}
+	return errors.Join(errs...)
+}
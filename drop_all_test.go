@@ -0,0 +1,59 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestCloseAndDropAll(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+	defer provider.Close()
+
+	suffix := time.Now().UnixNano()
+	dbNames := []string{
+		fmt.Sprintf("drop_all_first_%d", suffix),
+		fmt.Sprintf("drop_all_second_%d", suffix),
+	}
+	for _, dbName := range dbNames {
+		c.Assert(provider.CreateDatabaseFromTemplate(ctx, dbName, "template0"), qt.IsNil)
+		conn, err := provider.Connect(ctx, dbName)
+		c.Assert(err, qt.IsNil)
+		_, err = conn.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.IsNil)
+	}
+
+	// A session from elsewhere does not prevent the drop.
+	other := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+	defer other.Close()
+	otherConn, err := other.Connect(ctx, dbNames[0])
+	c.Assert(err, qt.IsNil)
+	_, err = otherConn.ExecContext(ctx, "SELECT 1")
+	c.Assert(err, qt.IsNil)
+
+	// Neither does a connection of the provider that was never released.
+	leaked, err := provider.AcquireConn(ctx, dbNames[1])
+	c.Assert(err, qt.IsNil)
+	defer leaked.Release()
+
+	dropCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	c.Assert(provider.CloseAndDropAll(dropCtx, "postgres"), qt.IsNil)
+	c.Assert(provider.NumPools(), qt.Equals, 1)
+
+	conn, err := provider.Connect(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+	var count int
+	err = conn.QueryRowContext(ctx, "SELECT count(*) FROM pg_database WHERE datname = ANY($1)", dbNames).Scan(&count)
+	c.Assert(err, qt.IsNil)
+	c.Assert(count, qt.Equals, 0)
+}
@@ -0,0 +1,67 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/puddle"
+)
+
+// IsNoRows reports whether err means that a query returned no rows,
+// e.g. when scanning the row returned by DatabaseConnection.QueryRowContext.
+func IsNoRows(err error) bool {
+	return errors.Is(err, pgx.ErrNoRows)
+}
+
+// IsConnectionError reports whether err is caused by the connection
+// to the database rather than by the query itself, e.g. a connection
+// that could not be acquired or established, a closed pool
+// or a server that terminated the connection.
+//
+// This tells apart a failed Scan of the row returned by
+// DatabaseConnection.QueryRowContext due to an exhausted pool
+// from a genuine scan error. A query cancelled or running past
+// the deadline of its context is not a connection error.
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var acquireErr acquireError
+	if errors.Is(err, ErrAcquireTimeout) || errors.Is(err, puddle.ErrClosedPool) || errors.As(err, &acquireErr) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return isConnectionErrorCode(pgErr.Code)
+	}
+
+	// Failed network operations, e.g. dial timeouts, are connection
+	// failures even though they match context.DeadlineExceeded.
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	// Context errors implement net.Error, but a query running
+	// past its deadline is not a connection failure.
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isConnectionErrorCode reports whether the SQLSTATE code reports
+// a broken connection: class 08 (connection exception), admin_shutdown,
+// crash_shutdown or cannot_connect_now.
+func isConnectionErrorCode(code string) bool {
+	switch code {
+	case "57P01", "57P02", "57P03":
+		return true
+	}
+	return strings.HasPrefix(code, "08")
+}
@@ -0,0 +1,89 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// StatementError reports the failure of a statement run by ExecAll.
+type StatementError struct {
+	// Index is the position of the failing statement.
+	Index int
+	// Err is the underlying failure.
+	Err error
+}
+
+// Error implements error.
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("statement %d failed: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the underlying failure.
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+// ExecAll runs the statements against the database in order,
+// e.g. to seed it. The pool is created if it does not exist yet.
+//
+// If atomic is true, the statements run in a single transaction, which
+// is rolled back on the first failure: a *StatementError is returned for
+// the failing statement and none of the statements take effect.
+// Otherwise, every statement runs on its own, even after failures,
+// and the *StatementError of each failing statement is returned,
+// joined with errors.Join.
+//
+// Like DatabaseConnection.ExecContext, the statements go through the
+// query middlewares (see WithQueryMiddleware), and are counted, logged
+// and recorded in the metrics.
+func (p *ConnectionProvider) ExecAll(ctx context.Context, databaseName string, statements []string, atomic bool) error {
+	entry, err := p.getOrCreateEntry(ctx, databaseName)
+	if err != nil {
+		return err
+	}
+	conn := p.queryConnection(databaseName, entry)
+
+	if !atomic {
+		var errs []error
+		for i, statement := range statements {
+			if _, err := conn.ExecContext(ctx, statement); err != nil {
+				errs = append(errs, &StatementError{Index: i, Err: err})
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	for i, statement := range statements {
+		if _, err := conn.execTx(ctx, tx, statement); err != nil {
+			stmtErr := &StatementError{Index: i, Err: err}
+			if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+				return errors.Join(stmtErr, rollbackErr)
+			}
+			return stmtErr
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// execTx executes a query within the transaction like ExecContext does
+// on the pool, through the query middlewares.
+func (c *DatabaseConnection) execTx(ctx context.Context, tx *Tx, query string, args ...any) (any, error) {
+	c.touch()
+	c.countExec(ctx)
+	c.logQuery(ctx, "Exec", query, args)
+
+	run := func(ctx context.Context, kind QueryKind, query string, args ...any) (any, error) {
+		if kind != QueryExec {
+			return nil, fmt.Errorf("unknown query kind %s", kind)
+		}
+		return tx.tx.Exec(ctx, query, args...)
+	}
+	return c.runQueryFunc(ctx, run, QueryExec, query, args)
+}
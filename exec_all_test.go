@@ -0,0 +1,112 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestExecAll(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+	defer provider.Close()
+
+	conn, err := provider.Connect(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+
+	// newTable creates a table for a subtest, dropped when the subtest ends.
+	newTable := func(c *qt.C, prefix string) string {
+		tableName := fmt.Sprintf("%s_%d", prefix, time.Now().UnixNano())
+		_, err := conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (id int PRIMARY KEY)", tableName))
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(func() {
+			_, err := conn.ExecContext(ctx, fmt.Sprintf("DROP TABLE %s", tableName))
+			c.Assert(err, qt.IsNil)
+		})
+		return tableName
+	}
+	count := func(c *qt.C, tableName string) int {
+		var n int
+		err := conn.QueryRowContext(ctx, fmt.Sprintf("SELECT count(*) FROM %s", tableName)).Scan(&n)
+		c.Assert(err, qt.IsNil)
+		return n
+	}
+
+	c.Run("Atomic success", func(c *qt.C) {
+		tableName := newTable(c, "exec_all_atomic_ok")
+		err := provider.ExecAll(ctx, "postgres", []string{
+			fmt.Sprintf("INSERT INTO %s VALUES (1)", tableName),
+			fmt.Sprintf("INSERT INTO %s VALUES (2)", tableName),
+		}, true)
+		c.Assert(err, qt.IsNil)
+		c.Assert(count(c, tableName), qt.Equals, 2)
+	})
+
+	c.Run("Atomic failure rolls back", func(c *qt.C) {
+		tableName := newTable(c, "exec_all_atomic_fail")
+		err := provider.ExecAll(ctx, "postgres", []string{
+			fmt.Sprintf("INSERT INTO %s VALUES (1)", tableName),
+			fmt.Sprintf("INSERT INTO %s VALUES (1)", tableName),
+			fmt.Sprintf("INSERT INTO %s VALUES (2)", tableName),
+		}, true)
+		var stmtErr *pgdbtemplatepgx.StatementError
+		c.Assert(errors.As(err, &stmtErr), qt.IsTrue)
+		c.Assert(stmtErr.Index, qt.Equals, 1)
+		c.Assert(err, qt.ErrorMatches, "statement 1 failed: .*duplicate key.*")
+		c.Assert(count(c, tableName), qt.Equals, 0)
+	})
+
+	c.Run("Best-effort failures are aggregated", func(c *qt.C) {
+		tableName := newTable(c, "exec_all_best_effort")
+		err := provider.ExecAll(ctx, "postgres", []string{
+			fmt.Sprintf("INSERT INTO %s VALUES (1)", tableName),
+			fmt.Sprintf("INSERT INTO %s VALUES (1)", tableName),
+			"SELECT * FROM exec_all_missing_table",
+			fmt.Sprintf("INSERT INTO %s VALUES (2)", tableName),
+		}, false)
+		c.Assert(err, qt.Not(qt.IsNil))
+
+		joined, ok := err.(interface{ Unwrap() []error })
+		c.Assert(ok, qt.IsTrue)
+		var indexes []int
+		for _, err := range joined.Unwrap() {
+			var stmtErr *pgdbtemplatepgx.StatementError
+			c.Assert(errors.As(err, &stmtErr), qt.IsTrue)
+			indexes = append(indexes, stmtErr.Index)
+		}
+		c.Assert(indexes, qt.DeepEquals, []int{1, 2})
+		c.Assert(count(c, tableName), qt.Equals, 2)
+	})
+
+	c.Run("Statements go through the query middlewares", func(c *qt.C) {
+		var queries []string
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithQueryMiddleware(func(next pgdbtemplatepgx.QueryFunc) pgdbtemplatepgx.QueryFunc {
+				return func(ctx context.Context, kind pgdbtemplatepgx.QueryKind, query string, args ...any) (any, error) {
+					queries = append(queries, query)
+					return next(ctx, kind, query, args...)
+				}
+			}),
+		)
+		defer provider.Close()
+
+		for _, atomic := range []bool{false, true} {
+			queries = nil
+			err := provider.ExecAll(ctx, "postgres", []string{"SELECT 1", "SELECT 2"}, atomic)
+			c.Assert(err, qt.IsNil)
+			c.Assert(queries, qt.DeepEquals, []string{"SELECT 1", "SELECT 2"}, qt.Commentf("atomic %v", atomic))
+		}
+		exec, _ := provider.QueryCounts("postgres")
+		c.Assert(exec, qt.Equals, int64(4))
+	})
+}
@@ -0,0 +1,35 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// WithPingHook installs a hook that runs before each pool health check.
+// A non-nil error from the hook fails the health check.
+func WithPingHook(hook func(ctx context.Context) error) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.pingHook = hook
+	}
+}
+
+// ParseConfig exposes the pool configuration Connect would use
+// for the database, without connecting.
+func (p *ConnectionProvider) ParseConfig(databaseName string) (*pgxpool.Config, error) {
+	return p.parseConfig(databaseName)
+}
+
+// Clock exposes the clock abstraction to tests.
+type Clock = clock
+
+// WithClock replaces the real clock used by the provider.
+func WithClock(c Clock) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.clock = c
+	}
+}
+
+// IsTerminatedConnection exposes whether WithReconnectOnAdminShutdown
+// retries a query failing with err.
+var IsTerminatedConnection = isTerminatedConnection
@@ -0,0 +1,109 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// connTracker keeps track of the open connections of a pool,
+// so that they can be closed or have their queries canceled
+// without waiting for them to be released.
+type connTracker struct {
+	mu    sync.Mutex
+	conns map[*pgx.Conn]struct{}
+}
+
+// track is an AfterConnect hook adding the connection to the tracker.
+//
+// Connections closed in the meantime are forgotten.
+func (t *connTracker) track(_ context.Context, conn *pgx.Conn) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conns == nil {
+		t.conns = make(map[*pgx.Conn]struct{})
+	}
+	for tracked := range t.conns {
+		select {
+		case <-tracked.PgConn().CleanupDone():
+			delete(t.conns, tracked)
+		default:
+		}
+	}
+	t.conns[conn] = struct{}{}
+	return nil
+}
+
+// closeAll closes the network connections of the tracked connections,
+// interrupting queries in flight. The server ends the sessions
+// as soon as it notices.
+func (t *connTracker) closeAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for conn := range t.conns {
+		// The error is irrelevant: the connection is gone either way.
+		_ = conn.PgConn().Conn().Close()
+	}
+	t.conns = nil
+}
+
+// cancelRequestTimeout bounds the cancel requests sent by cancelAll.
+const cancelRequestTimeout = 5 * time.Second
+
+// cancelAll asks the server to cancel the query running on each tracked
+// connection, if any, and waits for the requests to be sent.
+//
+// Cancel requests go through separate connections to the server,
+// which ignores them for sessions not running a query.
+func (t *connTracker) cancelAll(ctx context.Context) {
+	t.mu.Lock()
+	conns := make([]*pgx.Conn, 0, len(t.conns))
+	for conn := range t.conns {
+		select {
+		case <-conn.PgConn().CleanupDone():
+		default:
+			conns = append(conns, conn)
+		}
+	}
+	t.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, cancelRequestTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *pgx.Conn) {
+			defer wg.Done()
+			// The error is irrelevant: a connection whose request fails
+			// is closed with its pool all the same.
+			_ = conn.PgConn().CancelRequest(ctx)
+		}(conn)
+	}
+	wg.Wait()
+}
+
+// cancelInFlight cancels the queries running on the connections
+// of the pools if WithCancelInFlightOnClose is used.
+func (p *ConnectionProvider) cancelInFlight(entries map[*poolEntry]string) {
+	if !p.cancelInFlightOnClose {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for entry := range entries {
+		if entry.conns == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(conns *connTracker) {
+			defer wg.Done()
+			conns.cancelAll(context.Background())
+		}(entry.conns)
+	}
+	wg.Wait()
+}
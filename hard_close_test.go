@@ -0,0 +1,123 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/jackc/pgconn"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestHardClose(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	c.Run("Close returns promptly with an outstanding connection", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithHardClose(),
+		)
+
+		outstanding, err := provider.AcquireConn(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		// Let the pool finish closing in the background.
+		defer outstanding.Release()
+		pid := outstanding.Raw().PgConn().PID()
+
+		start := time.Now()
+		c.Assert(provider.Close(), qt.IsNil)
+		c.Assert(time.Since(start) < 5*time.Second, qt.IsTrue)
+
+		// The outstanding connection has been closed under its holder.
+		_, err = outstanding.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.Not(qt.IsNil))
+
+		// The server ends the session.
+		observer := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer observer.Close()
+		conn, err := observer.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer conn.Close()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			var exists bool
+			err := conn.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_stat_activity WHERE pid = $1)", int64(pid)).Scan(&exists)
+			c.Assert(err, qt.IsNil)
+			if !exists {
+				break
+			}
+			c.Assert(time.Now().Before(deadline), qt.IsTrue, qt.Commentf("backend %d still running", pid))
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	c.Run("Pool without outstanding connections", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithHardClose(),
+		)
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		_, err = conn.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.IsNil)
+		c.Assert(conn.Close(), qt.IsNil)
+		c.Assert(provider.Close(), qt.IsNil)
+	})
+}
+
+func TestCancelInFlightOnClose(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	provider := pgdbtemplatepgx.NewConnectionProvider(
+		testConnectionStringFuncPgx,
+		pgdbtemplatepgx.WithCancelInFlightOnClose(),
+	)
+
+	conn, err := provider.Connect(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+
+	const query = "SELECT pg_sleep(60) -- TestCancelInFlightOnClose"
+	queryErr := make(chan error, 1)
+	go func() {
+		_, err := conn.ExecContext(ctx, query)
+		queryErr <- err
+	}()
+
+	// Wait for the query to run on the server.
+	observer := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+	defer observer.Close()
+	observerConn, err := observer.Connect(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var running bool
+		err := observerConn.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM pg_stat_activity WHERE state = 'active' AND query = $1)", query,
+		).Scan(&running)
+		c.Assert(err, qt.IsNil)
+		if running {
+			break
+		}
+		c.Assert(time.Now().Before(deadline), qt.IsTrue, qt.Commentf("query not running"))
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	start := time.Now()
+	c.Assert(provider.Close(), qt.IsNil)
+	c.Assert(time.Since(start) < 10*time.Second, qt.IsTrue)
+
+	var pgErr *pgconn.PgError
+	c.Assert(errors.As(<-queryErr, &pgErr), qt.IsTrue)
+	c.Assert(pgErr.Code, qt.Equals, "57014")
+}
@@ -0,0 +1,54 @@
+package pgdbtemplatepgxv4
+
+import "time"
+
+// reapWhenIdle schedules the entry cached for the database to be closed
+// and removed once it has not been used for the timeout set via
+// WithIdlePoolTimeout, as measured by the provider's clock.
+// It is a no-op without the option.
+func (p *ConnectionProvider) reapWhenIdle(databaseName string, entry *poolEntry) {
+	if p.idlePoolTimeout <= 0 {
+		return
+	}
+	p.scheduleReap(databaseName, entry, entry.lastUsedAt().Add(p.idlePoolTimeout).Sub(p.clock.Now()))
+}
+
+// scheduleReap checks whether the entry is idle after d.
+func (p *ConnectionProvider) scheduleReap(databaseName string, entry *poolEntry, d time.Duration) {
+	p.clock.AfterFunc(d, func() {
+		p.reapIfIdle(databaseName, entry)
+	})
+}
+
+// reapIfIdle closes and removes the entry if it is still cached for
+// the database and idle, and checks again later otherwise.
+func (p *ConnectionProvider) reapIfIdle(databaseName string, entry *poolEntry) {
+	select {
+	case <-entry.retired:
+		return
+	default:
+	}
+
+	if entry.pool.Stat().AcquiredConns() > 0 {
+		// The pool is in use, e.g. by a transaction: it is not idle
+		// until its connections are released.
+		p.scheduleReap(databaseName, entry, p.idlePoolTimeout)
+		return
+	}
+	if idle := p.clock.Now().Sub(entry.lastUsedAt()); idle < p.idlePoolTimeout {
+		p.scheduleReap(databaseName, entry, p.idlePoolTimeout-idle)
+		return
+	}
+
+	p.mu.Lock()
+	owned := p.pools[databaseName] == entry
+	if owned {
+		delete(p.pools, databaseName)
+	}
+	p.mu.Unlock()
+
+	// Closing waits for checked-out connections, so do it outside the lock.
+	if owned {
+		entry.close()
+	}
+}
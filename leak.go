@@ -0,0 +1,117 @@
+package pgdbtemplatepgxv4
+
+import (
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Leak describes a connection acquired from a pool and not released
+// within the grace period set via WithLeakDetection.
+type Leak struct {
+	// DatabaseName is the database of the pool.
+	DatabaseName string
+	// AcquiredAt is when the connection was acquired.
+	AcquiredAt time.Time
+	// Stack is the stack trace of the goroutine that acquired the connection.
+	Stack []byte
+}
+
+// leakDetector tracks the connections acquired through the provider,
+// e.g. via AcquireConn, to report those held for too long.
+type leakDetector struct {
+	threshold int
+	grace     time.Duration
+	onLeak    func(Leak)
+
+	mu       sync.Mutex
+	acquired map[*pgx.Conn]*Leak
+}
+
+// track records that conn has been acquired from the pool of the database
+// and schedules a check for whether it leaked on clk.
+func (d *leakDetector) track(clk clock, databaseName string, conn *pgx.Conn) {
+	leak := &Leak{
+		DatabaseName: databaseName,
+		AcquiredAt:   clk.Now(),
+		Stack:        debug.Stack(),
+	}
+
+	d.mu.Lock()
+	if d.acquired == nil {
+		d.acquired = make(map[*pgx.Conn]*Leak)
+	}
+	d.acquired[conn] = leak
+	d.mu.Unlock()
+
+	clk.AfterFunc(d.grace, func() {
+		if d.leaked(conn, leak) {
+			d.onLeak(*leak)
+		}
+	})
+}
+
+// leaked reports whether the acquisition of conn is still outstanding
+// and the pool has more outstanding acquisitions than the threshold.
+func (d *leakDetector) leaked(conn *pgx.Conn, leak *Leak) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.acquired[conn] != leak {
+		return false
+	}
+	select {
+	case <-conn.PgConn().CleanupDone():
+		// Closed connections are destroyed on release without AfterRelease.
+		delete(d.acquired, conn)
+		return false
+	default:
+	}
+
+	outstanding := 0
+	for _, other := range d.acquired {
+		if other.DatabaseName == leak.DatabaseName {
+			outstanding++
+		}
+	}
+	return outstanding > d.threshold
+}
+
+// release forgets the acquisition of conn. It is an AfterRelease hook.
+func (d *leakDetector) release(conn *pgx.Conn) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.acquired, conn)
+}
+
+// afterRelease returns the AfterRelease hook for pools: the user-provided
+// hook, preceded by forgetting the acquisition if leaks are detected.
+func (p *ConnectionProvider) afterRelease() func(*pgx.Conn) bool {
+	afterRelease := p.poolConfig.AfterRelease
+	if p.leaks == nil {
+		return afterRelease
+	}
+
+	return func(conn *pgx.Conn) bool {
+		p.leaks.release(conn)
+		if afterRelease == nil {
+			return true
+		}
+		return afterRelease(conn)
+	}
+}
+
+// trackAcquire records the acquisition of conn from the pool of entry
+// if leaks are detected.
+//
+// Connections of pools not configured by the provider, e.g. registered
+// via RegisterPool, are not tracked, since the pools lack the AfterRelease
+// hook forgetting them.
+func (p *ConnectionProvider) trackAcquire(entry *poolEntry, databaseName string, conn *pgx.Conn) {
+	if p.leaks != nil && entry != nil && !entry.external {
+		p.leaks.track(p.clock, databaseName, conn)
+	}
+}
@@ -0,0 +1,149 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestLeakDetection(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	const grace = time.Minute
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// newProvider returns a provider detecting leaks on a fake clock,
+	// reporting them on the returned channel.
+	newProvider := func(c *qt.C, threshold int) (*pgdbtemplatepgx.ConnectionProvider, *fakeClock, chan pgdbtemplatepgx.Leak) {
+		fc := &fakeClock{now: start}
+		leaks := make(chan pgdbtemplatepgx.Leak, 10)
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithClock(fc),
+			pgdbtemplatepgx.WithLeakDetection(threshold, grace, func(leak pgdbtemplatepgx.Leak) {
+				leaks <- leak
+			}),
+		)
+		c.Cleanup(func() { provider.Close() })
+		return provider, fc, leaks
+	}
+
+	// assertLeak asserts that a leak has been reported for postgres.
+	assertLeak := func(c *qt.C, leaks chan pgdbtemplatepgx.Leak) {
+		select {
+		case leak := <-leaks:
+			c.Assert(leak.DatabaseName, qt.Equals, "postgres")
+			c.Assert(leak.AcquiredAt, qt.Equals, start)
+			c.Assert(string(leak.Stack), qt.Contains, "TestLeakDetection")
+		default:
+			c.Fatal("expected a leak to be reported")
+		}
+	}
+
+	c.Run("Leaked connection is reported", func(c *qt.C) {
+		c.Parallel()
+		provider, fc, leaks := newProvider(c, 0)
+
+		leaked, err := provider.AcquireConn(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer leaked.Release()
+
+		fc.Advance(grace - time.Second)
+		c.Assert(leaks, qt.HasLen, 0)
+		fc.Advance(time.Second)
+		assertLeak(c, leaks)
+	})
+
+	c.Run("Unscanned row is reported", func(c *qt.C) {
+		c.Parallel()
+		provider, fc, leaks := newProvider(c, 0)
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		row := conn.QueryRowContext(ctx, "SELECT 1")
+
+		fc.Advance(grace)
+		assertLeak(c, leaks)
+
+		var one int
+		c.Assert(row.Scan(&one), qt.IsNil)
+	})
+
+	c.Run("Unfinished transaction is reported", func(c *qt.C) {
+		c.Parallel()
+		provider, fc, leaks := newProvider(c, 0)
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		tx, err := conn.(*pgdbtemplatepgx.DatabaseConnection).BeginTx(ctx, pgx.TxOptions{})
+		c.Assert(err, qt.IsNil)
+
+		fc.Advance(grace)
+		assertLeak(c, leaks)
+
+		c.Assert(tx.Rollback(ctx), qt.IsNil)
+	})
+
+	c.Run("Released connections and the threshold are respected", func(c *qt.C) {
+		c.Parallel()
+		provider, fc, leaks := newProvider(c, 1)
+
+		released, err := provider.AcquireConn(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		released.Release()
+		// The release is processed in the background.
+		for {
+			stat, err := provider.Stats("postgres")
+			c.Assert(err, qt.IsNil)
+			if stat.AcquiredConns() == 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		// A single held connection does not exceed the threshold.
+		held, err := provider.AcquireConn(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer held.Release()
+
+		fc.Advance(grace)
+		select {
+		case leak := <-leaks:
+			c.Fatalf("unexpected leak reported:\n%s", leak.Stack)
+		default:
+		}
+	})
+
+	c.Run("Connections of registered pools are not tracked", func(c *qt.C) {
+		c.Parallel()
+		provider, fc, leaks := newProvider(c, 0)
+
+		pool, err := pgxpool.Connect(ctx, testConnectionString)
+		c.Assert(err, qt.IsNil)
+		c.Assert(provider.RegisterPool("postgres", pool), qt.IsNil)
+
+		// The registered pool lacks the hook forgetting released connections.
+		handle, err := provider.AcquireConn(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		handle.Release()
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		var one int
+		c.Assert(conn.QueryRowContext(ctx, "SELECT 1").Scan(&one), qt.IsNil)
+
+		fc.Advance(grace)
+		select {
+		case leak := <-leaks:
+			c.Fatalf("unexpected leak reported:\n%s", leak.Stack)
+		default:
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+
+	"github.com/andrei-polukhin/pgdbtemplate"
+)
+
+// ConnectWithLifetime is like Connect, but ties the pool for the database
+// to ctx: once ctx is done, the pool is closed and removed from the provider
+// in the background. This suits per-test contexts for automatic cleanup.
+//
+// Only a pool created by this call is tied to ctx: if the pool existed
+// before, it is reused as with Connect and outlives ctx, so that other
+// users of the pool are not affected. The background watcher exits as
+// soon as the pool is closed or removed by other means,
+// e.g. DatabaseConnection.Close or provider Close.
+func (p *ConnectionProvider) ConnectWithLifetime(ctx context.Context, databaseName string) (pgdbtemplate.DatabaseConnection, error) {
+	entry, created, err := p.getOrCreate(ctx, databaseName)
+	if err != nil {
+		return nil, err
+	}
+
+	if created {
+		go p.closeWhenDone(ctx, databaseName, entry)
+	}
+
+	return p.newConnection(databaseName, entry), nil
+}
+
+// closeWhenDone closes and removes the entry once ctx is done,
+// unless the entry is retired first.
+func (p *ConnectionProvider) closeWhenDone(ctx context.Context, databaseName string, entry *poolEntry) {
+	select {
+	case <-ctx.Done():
+	case <-entry.retired:
+		return
+	}
+
+	p.mu.Lock()
+	current, exists := p.pools[databaseName]
+	owned := exists && current == entry
+	if owned {
+		delete(p.pools, databaseName)
+	}
+	p.mu.Unlock()
+
+	// Closing waits for checked-out connections, so do it outside the lock.
+	if owned {
+		entry.close()
+	}
+}
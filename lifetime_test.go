@@ -0,0 +1,89 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestConnectWithLifetime(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	// eventually waits up to a few seconds for cond to hold.
+	eventually := func(cond func() bool) bool {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if cond() {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	c.Run("Pool is closed when the context is cancelled", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		conn, err := provider.ConnectWithLifetime(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		_, err = conn.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.IsNil)
+		c.Assert(provider.NumPools(), qt.Equals, 1)
+
+		cancel()
+		c.Assert(eventually(func() bool { return provider.NumPools() == 0 }), qt.IsTrue)
+
+		_, err = conn.ExecContext(context.Background(), "SELECT 1")
+		c.Assert(pgdbtemplatepgx.IsConnectionError(err), qt.IsTrue)
+	})
+
+	c.Run("Pool closed first is not tied to the context any more", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		conn, err := provider.ConnectWithLifetime(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		c.Assert(conn.Close(), qt.IsNil)
+
+		// A later pool for the same database is not affected by the context.
+		conn, err = provider.Connect(context.Background(), "postgres")
+		c.Assert(err, qt.IsNil)
+		cancel()
+		time.Sleep(50 * time.Millisecond)
+		c.Assert(provider.NumPools(), qt.Equals, 1)
+		c.Assert(conn.Close(), qt.IsNil)
+	})
+
+	c.Run("Existing pool is not tied to the context", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		conn, err := provider.Connect(context.Background(), "postgres")
+		c.Assert(err, qt.IsNil)
+		defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err = provider.ConnectWithLifetime(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		cancel()
+		time.Sleep(50 * time.Millisecond)
+
+		// The pool created by Connect stays usable.
+		c.Assert(provider.NumPools(), qt.Equals, 1)
+		_, err = conn.ExecContext(context.Background(), "SELECT 1")
+		c.Assert(err, qt.IsNil)
+	})
+}
@@ -0,0 +1,48 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// maintenanceOps are the operations allowed by Maintenance.
+var maintenanceOps = map[string]bool{
+	"ANALYZE":             true,
+	"VACUUM":              true,
+	"VACUUM ANALYZE":      true,
+	"VACUUM FULL":         true,
+	"VACUUM FULL ANALYZE": true,
+}
+
+// Maintenance runs maintenance operations against the whole database,
+// e.g. ANALYZE after seeding a template database, so that test databases
+// cloned from it start with realistic planner statistics.
+//
+// The operations are one of ANALYZE, VACUUM, VACUUM ANALYZE, VACUUM FULL
+// and VACUUM FULL ANALYZE, in any case. They are all validated before any
+// runs, and run in order using the simple protocol, outside of
+// a transaction. The pool is created if it does not exist yet.
+func (p *ConnectionProvider) Maintenance(ctx context.Context, databaseName string, ops ...string) error {
+	statements := make([]string, 0, len(ops))
+	for _, op := range ops {
+		statement := strings.ToUpper(strings.Join(strings.Fields(op), " "))
+		if !maintenanceOps[statement] {
+			return fmt.Errorf("unsupported maintenance operation %q", op)
+		}
+		statements = append(statements, statement)
+	}
+
+	entry, err := p.getOrCreateEntry(ctx, databaseName)
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if _, err := entry.pool.Exec(ctx, statement, pgx.QuerySimpleProtocol(true)); err != nil {
+			return fmt.Errorf("failed to run %s: %w", statement, err)
+		}
+	}
+	return nil
+}
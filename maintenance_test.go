@@ -0,0 +1,65 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestMaintenance(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	c.Run("Allowed operations", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		err := provider.Maintenance(ctx, "postgres", "analyze", " VACUUM   analyze ")
+		c.Assert(err, qt.IsNil)
+	})
+
+	c.Run("ANALYZE on a seeded table", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		dbName := fmt.Sprintf("maintenance_%d", time.Now().UnixNano())
+		c.Assert(provider.CreateDatabaseFromTemplate(ctx, dbName, "template0"), qt.IsNil)
+		defer dropDatabase(c, provider, dbName)
+
+		conn, err := provider.Connect(ctx, dbName)
+		c.Assert(err, qt.IsNil)
+		defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+		_, err = conn.ExecContext(ctx, "CREATE TABLE test_table (id SERIAL PRIMARY KEY, name TEXT)")
+		c.Assert(err, qt.IsNil)
+		_, err = conn.ExecContext(ctx, "INSERT INTO test_table (name) VALUES ('first'), ('second'), ('third')")
+		c.Assert(err, qt.IsNil)
+
+		// ANALYZE updates the planner statistics of the seeded table.
+		c.Assert(provider.Maintenance(ctx, dbName, "ANALYZE"), qt.IsNil)
+		var reltuples float64
+		err = conn.QueryRowContext(ctx, "SELECT reltuples FROM pg_class WHERE oid = 'test_table'::regclass").Scan(&reltuples)
+		c.Assert(err, qt.IsNil)
+		c.Assert(reltuples, qt.Equals, float64(3))
+	})
+
+	c.Run("Disallowed operations are rejected before running any", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		err := provider.Maintenance(ctx, "postgres", "ANALYZE", "DROP TABLE users")
+		c.Assert(err, qt.ErrorMatches, `unsupported maintenance operation "DROP TABLE users"`)
+		c.Assert(provider.NumPools(), qt.Equals, 0)
+
+		err = provider.Maintenance(ctx, "postgres", "ANALYZE; DROP TABLE users")
+		c.Assert(err, qt.ErrorMatches, `unsupported maintenance operation .*`)
+	})
+}
@@ -0,0 +1,67 @@
+package pgdbtemplatepgxv4
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// marshaledConfig is the serializable form of a pool configuration.
+//
+// It deliberately has no field for secrets such as the password.
+type marshaledConfig struct {
+	Database             string
+	Host                 string
+	Port                 uint16
+	User                 string
+	MaxConns             int32
+	MinConns             int32
+	MaxConnLifetime      string
+	MaxConnIdleTime      string
+	HealthCheckPeriod    string
+	LazyConnect          bool
+	PreferSimpleProtocol bool
+	RuntimeParams        map[string]string
+}
+
+// MarshalConfig returns the effective configuration of the cached pool
+// for the database as JSON, e.g. to record in CI artifacts how pools
+// were configured.
+//
+// Secrets are never serialized: the password is omitted, and so are
+// runtime parameters whose name mentions a password.
+// ErrPoolNotFound is returned if the provider has no pool for the database.
+func (p *ConnectionProvider) MarshalConfig(databaseName string) ([]byte, error) {
+	entry, err := p.lookupEntry(databaseName)
+	if err != nil {
+		return nil, err
+	}
+	config := entry.pool.Config()
+
+	runtimeParams := make(map[string]string, len(config.ConnConfig.RuntimeParams))
+	for name, value := range config.ConnConfig.RuntimeParams {
+		if strings.Contains(strings.ToLower(name), "password") {
+			continue
+		}
+		runtimeParams[name] = value
+	}
+
+	data, err := json.Marshal(marshaledConfig{
+		Database:             config.ConnConfig.Database,
+		Host:                 config.ConnConfig.Host,
+		Port:                 config.ConnConfig.Port,
+		User:                 config.ConnConfig.User,
+		MaxConns:             config.MaxConns,
+		MinConns:             config.MinConns,
+		MaxConnLifetime:      config.MaxConnLifetime.String(),
+		MaxConnIdleTime:      config.MaxConnIdleTime.String(),
+		HealthCheckPeriod:    config.HealthCheckPeriod.String(),
+		LazyConnect:          config.LazyConnect,
+		PreferSimpleProtocol: config.ConnConfig.PreferSimpleProtocol,
+		RuntimeParams:        runtimeParams,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal pool config: %w", err)
+	}
+	return data, nil
+}
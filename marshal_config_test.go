@@ -0,0 +1,64 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/jackc/pgx/v4"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestMarshalConfig(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	c.Run("Effective config without secrets", func(c *qt.C) {
+		c.Parallel()
+		connStringFunc := func(dbName string) string {
+			return withConnParam(testConnectionStringFuncPgx(dbName), "application_name", "marshal_test")
+		}
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			connStringFunc,
+			pgdbtemplatepgx.WithMaxConns(7),
+			pgdbtemplatepgx.WithMaxConnLifetime(time.Hour),
+		)
+		defer provider.Close()
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+
+		data, err := provider.MarshalConfig("postgres")
+		c.Assert(err, qt.IsNil)
+
+		var config map[string]any
+		c.Assert(json.Unmarshal(data, &config), qt.IsNil)
+		c.Assert(config["MaxConns"], qt.Equals, float64(7))
+		c.Assert(config["MaxConnLifetime"], qt.Equals, "1h0m0s")
+		c.Assert(config["Database"], qt.Equals, "postgres")
+		c.Assert(config["RuntimeParams"], qt.DeepEquals, map[string]any{"application_name": "marshal_test"})
+
+		c.Assert(strings.Contains(strings.ToLower(string(data)), "password"), qt.IsFalse)
+		connConfig, err := pgx.ParseConfig(connStringFunc("postgres"))
+		c.Assert(err, qt.IsNil)
+		// The check is meaningless for passwords equal to other, serialized settings.
+		if password := connConfig.Password; password != "" && password != connConfig.User && password != connConfig.Database {
+			c.Assert(strings.Contains(string(data), connConfig.Password), qt.IsFalse)
+		}
+	})
+
+	c.Run("Missing pool", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		_, err := provider.MarshalConfig("postgres")
+		c.Assert(err, qt.ErrorIs, pgdbtemplatepgx.ErrPoolNotFound)
+	})
+}
@@ -0,0 +1,151 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Names of the metrics emitted when WithMeter is used.
+const (
+	metricPools           = "pgdbtemplate.pools"
+	metricConnections     = "pgdbtemplate.connections"
+	metricAcquireDuration = "pgdbtemplate.acquire.duration"
+	metricQueries         = "pgdbtemplate.queries"
+)
+
+// providerIDs numbers the providers recording metrics, so that providers
+// sharing a meter can be told apart.
+var providerIDs atomic.Int64
+
+// providerMetrics holds the instruments registered against the meter
+// set via WithMeter.
+//
+// A nil *providerMetrics records nothing.
+type providerMetrics struct {
+	// provider is the attribute identifying the provider in every metric.
+	provider        attribute.KeyValue
+	acquireDuration metric.Float64Histogram
+	queries         metric.Int64Counter
+	// registration is the callback observing the pools, if any.
+	registration metric.Registration
+}
+
+// newProviderMetrics registers the instruments of the provider
+// against the meter.
+//
+// Pool sizes are observed from the provider's cached pools on each
+// collection, until the provider is closed. Every metric carries
+// a pgdbtemplate.provider.id attribute unique to the provider.
+// Instruments failing to register are reported to the global
+// OpenTelemetry error handler and do not record anything.
+func newProviderMetrics(p *ConnectionProvider, meter metric.Meter) *providerMetrics {
+	m := &providerMetrics{
+		provider: attribute.Int64("pgdbtemplate.provider.id", providerIDs.Add(1)),
+	}
+
+	var err error
+	m.acquireDuration, err = meter.Float64Histogram(metricAcquireDuration,
+		metric.WithDescription("Duration of acquiring a connection from a pool."),
+		metric.WithUnit("s"))
+	if err != nil {
+		otel.Handle(err)
+	}
+	m.queries, err = meter.Int64Counter(metricQueries,
+		metric.WithDescription("Number of queries run through database connections."),
+		metric.WithUnit("{query}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	pools, err := meter.Int64ObservableGauge(metricPools,
+		metric.WithDescription("Number of pools cached by the provider."),
+		metric.WithUnit("{pool}"))
+	if err != nil {
+		otel.Handle(err)
+		return m
+	}
+	connections, err := meter.Int64ObservableGauge(metricConnections,
+		metric.WithDescription("Number of connections in a pool by state."),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		otel.Handle(err)
+		return m
+	}
+	m.registration, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		p.mu.RLock()
+		defer p.mu.RUnlock()
+
+		o.ObserveInt64(pools, int64(len(p.pools)), metric.WithAttributes(m.provider))
+		for databaseName, entry := range p.pools {
+			stat := entry.pool.Stat()
+			o.ObserveInt64(connections, int64(stat.AcquiredConns()), metric.WithAttributes(
+				m.provider,
+				attribute.String("db.name", databaseName),
+				attribute.String("state", "used"),
+			))
+			o.ObserveInt64(connections, int64(stat.IdleConns()), metric.WithAttributes(
+				m.provider,
+				attribute.String("db.name", databaseName),
+				attribute.String("state", "idle"),
+			))
+		}
+		return nil
+	}, pools, connections)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return m
+}
+
+// close stops observing the pools of the provider.
+func (m *providerMetrics) close() {
+	if m == nil || m.registration == nil {
+		return
+	}
+	if err := m.registration.Unregister(); err != nil {
+		otel.Handle(err)
+	}
+}
+
+// recordQuery counts a query of the given kind on the database.
+func (m *providerMetrics) recordQuery(ctx context.Context, databaseName string, kind QueryKind) {
+	if m == nil || m.queries == nil {
+		return
+	}
+	m.queries.Add(ctx, 1, metric.WithAttributes(
+		m.provider,
+		attribute.String("db.name", databaseName),
+		attribute.String("db.operation", kind.String()),
+	))
+}
+
+// recordAcquire records how long acquiring a connection to the database took.
+func (m *providerMetrics) recordAcquire(ctx context.Context, databaseName string, d time.Duration) {
+	if m == nil || m.acquireDuration == nil {
+		return
+	}
+	m.acquireDuration.Record(ctx, d.Seconds(), metric.WithAttributes(
+		m.provider,
+		attribute.String("db.name", databaseName),
+	))
+}
+
+// acquire acquires a connection from the pool of the database,
+// recording the acquisition duration if WithMeter has been used
+// and the acquisition itself if WithLeakDetection has been used.
+func (p *ConnectionProvider) acquire(ctx context.Context, databaseName string, entry *poolEntry) (*pgxpool.Conn, error) {
+	start := time.Now()
+	conn, err := entry.pool.Acquire(ctx)
+	p.metrics.recordAcquire(ctx, databaseName, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+	p.trackAcquire(entry, databaseName, conn.Conn())
+	return conn, nil
+}
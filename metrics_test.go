@@ -0,0 +1,131 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestMeter(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	c.Run("Queries and pools are recorded", func(c *qt.C) {
+		c.Parallel()
+		reader := sdkmetric.NewManualReader()
+		meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+		defer meterProvider.Shutdown(ctx)
+
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithMeter(meterProvider.Meter("test")),
+		)
+		defer provider.Close()
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		_, err = conn.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.IsNil)
+		handle, err := provider.AcquireConn(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		handle.Release()
+
+		var rm metricdata.ResourceMetrics
+		c.Assert(reader.Collect(ctx, &rm), qt.IsNil)
+
+		queries, ok := findMetric(rm, "pgdbtemplate.queries").(metricdata.Sum[int64])
+		c.Assert(ok, qt.IsTrue)
+		c.Assert(queries.DataPoints, qt.HasLen, 1)
+		c.Assert(queries.DataPoints[0].Value, qt.Equals, int64(1))
+		operation, _ := queries.DataPoints[0].Attributes.Value(attribute.Key("db.operation"))
+		c.Assert(operation.AsString(), qt.Equals, "Exec")
+
+		pools, ok := findMetric(rm, "pgdbtemplate.pools").(metricdata.Gauge[int64])
+		c.Assert(ok, qt.IsTrue)
+		c.Assert(pools.DataPoints, qt.HasLen, 1)
+		c.Assert(pools.DataPoints[0].Value, qt.Equals, int64(1))
+
+		acquires, ok := findMetric(rm, "pgdbtemplate.acquire.duration").(metricdata.Histogram[float64])
+		c.Assert(ok, qt.IsTrue)
+		c.Assert(acquires.DataPoints, qt.HasLen, 1)
+		c.Assert(acquires.DataPoints[0].Count, qt.Equals, uint64(1))
+
+		// Closing the pool is reflected in the next collection.
+		c.Assert(conn.Close(), qt.IsNil)
+		c.Assert(reader.Collect(ctx, &rm), qt.IsNil)
+		pools, ok = findMetric(rm, "pgdbtemplate.pools").(metricdata.Gauge[int64])
+		c.Assert(ok, qt.IsTrue)
+		c.Assert(pools.DataPoints[0].Value, qt.Equals, int64(0))
+	})
+
+	c.Run("Providers sharing a meter", func(c *qt.C) {
+		c.Parallel()
+		reader := sdkmetric.NewManualReader()
+		meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+		defer meterProvider.Shutdown(ctx)
+
+		meter := pgdbtemplatepgx.WithMeter(meterProvider.Meter("test"))
+		first := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx, meter)
+		defer first.Close()
+		second := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx, meter)
+		defer second.Close()
+
+		conn, err := first.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer conn.Close()
+
+		// Each provider reports its own pools.
+		var rm metricdata.ResourceMetrics
+		c.Assert(reader.Collect(ctx, &rm), qt.IsNil)
+		pools, ok := findMetric(rm, "pgdbtemplate.pools").(metricdata.Gauge[int64])
+		c.Assert(ok, qt.IsTrue)
+		c.Assert(pools.DataPoints, qt.HasLen, 2)
+		ids := make(map[int64]int64)
+		for _, point := range pools.DataPoints {
+			id, ok := point.Attributes.Value(attribute.Key("pgdbtemplate.provider.id"))
+			c.Assert(ok, qt.IsTrue)
+			ids[id.AsInt64()] = point.Value
+		}
+		c.Assert(ids, qt.HasLen, 2)
+
+		// A closed provider is no longer observed.
+		second.Close()
+		c.Assert(reader.Collect(ctx, &rm), qt.IsNil)
+		pools, ok = findMetric(rm, "pgdbtemplate.pools").(metricdata.Gauge[int64])
+		c.Assert(ok, qt.IsTrue)
+		c.Assert(pools.DataPoints, qt.HasLen, 1)
+		c.Assert(pools.DataPoints[0].Value, qt.Equals, int64(1))
+	})
+
+	c.Run("No meter", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+
+		_, err = conn.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.IsNil)
+	})
+}
+
+// findMetric returns the data of the named metric, or nil if it is missing.
+func findMetric(rm metricdata.ResourceMetrics, name string) metricdata.Aggregation {
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	return nil
+}
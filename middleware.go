@@ -0,0 +1,151 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/andrei-polukhin/pgdbtemplate"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// QueryKind tells which DatabaseConnection method a query comes from.
+type QueryKind int
+
+const (
+	// QueryExec is a query run via ExecContext.
+	// Its result is the pgconn.CommandTag of the query.
+	QueryExec QueryKind = iota
+	// QueryRow is a query run via QueryRowContext.
+	// Its result is the pgdbtemplate.Row to scan; since errors of such
+	// queries are deferred until Scan, the error is normally nil.
+	QueryRow
+)
+
+// String returns the name of the query kind.
+func (k QueryKind) String() string {
+	switch k {
+	case QueryExec:
+		return "Exec"
+	case QueryRow:
+		return "QueryRow"
+	default:
+		return fmt.Sprintf("QueryKind(%d)", int(k))
+	}
+}
+
+// QueryFunc runs a query of the given kind through a DatabaseConnection.
+type QueryFunc func(ctx context.Context, kind QueryKind, query string, args ...any) (any, error)
+
+// runQuery runs the query on the pool through the query middlewares
+// of the provider, unless the database is paused.
+func (c *DatabaseConnection) runQuery(ctx context.Context, kind QueryKind, query string, args []any) (any, error) {
+	var hold func(conn *pgx.Conn)
+	if c.provider != nil {
+		hold = func(conn *pgx.Conn) {
+			c.provider.trackAcquire(c.entry, c.dbName, conn)
+		}
+	}
+	run := poolQueryFunc(c.Pool, hold)
+	if c.provider != nil && c.provider.reconnectOnAdminShutdown {
+		run = reconnectQueryFunc(c.Pool, run)
+	}
+	return c.runQueryFunc(ctx, run, kind, query, args)
+}
+
+// runQueryFunc runs the query with run, e.g. within a transaction,
+// through the query middlewares of the provider, unless the database
+// is paused.
+func (c *DatabaseConnection) runQueryFunc(ctx context.Context, run QueryFunc, kind QueryKind, query string, args []any) (any, error) {
+	if err := c.checkPaused(); err != nil {
+		return nil, err
+	}
+
+	if c.provider != nil {
+		// Wrap in reverse so that the first middleware registered is the outermost.
+		for i := len(c.provider.queryMiddlewares) - 1; i >= 0; i-- {
+			run = c.provider.queryMiddlewares[i](run)
+		}
+	}
+	return run(ctx, kind, query, args...)
+}
+
+// poolQueryFunc returns the QueryFunc running queries on the pool.
+//
+// Connections are acquired explicitly rather than by the pool's Exec
+// and QueryRow, so that acquisition failures are told apart from
+// query failures (see IsConnectionError). The connections of QueryRow
+// queries, held until their row is scanned, are passed to hold if not nil.
+func poolQueryFunc(pool *pgxpool.Pool, hold func(conn *pgx.Conn)) QueryFunc {
+	return func(ctx context.Context, kind QueryKind, query string, args ...any) (any, error) {
+		conn, err := pool.Acquire(ctx)
+		if err != nil {
+			return nil, acquireError{err: err}
+		}
+
+		switch kind {
+		case QueryExec:
+			defer conn.Release()
+			return conn.Exec(ctx, query, args...)
+		case QueryRow:
+			if hold != nil {
+				hold(conn.Conn())
+			}
+			return releasingRow{row: conn.QueryRow(ctx, query, args...), conn: conn}, nil
+		default:
+			conn.Release()
+			return nil, fmt.Errorf("unknown query kind %s", kind)
+		}
+	}
+}
+
+// acquireError reports that no connection could be acquired
+// from the pool to run a query, e.g. because the pool stayed
+// exhausted until the context was done.
+type acquireError struct {
+	err error
+}
+
+// Error implements the error interface.
+func (e acquireError) Error() string {
+	return "failed to acquire connection: " + e.err.Error()
+}
+
+// Unwrap returns the underlying failure.
+func (e acquireError) Unwrap() error {
+	return e.err
+}
+
+// releasingRow is a row releasing its connection once scanned.
+type releasingRow struct {
+	row  pgdbtemplate.Row
+	conn *pgxpool.Conn
+}
+
+// Scan implements pgdbtemplate.Row.Scan.
+func (r releasingRow) Scan(dest ...any) error {
+	defer r.conn.Release()
+	return r.row.Scan(dest...)
+}
+
+// errRow is a pgdbtemplate.Row whose Scan reports an error.
+type errRow struct {
+	err error
+}
+
+// Scan implements pgdbtemplate.Row.Scan.
+func (r errRow) Scan(...any) error {
+	return r.err
+}
+
+// asRow converts the result of a QueryRow query to a pgdbtemplate.Row.
+func asRow(result any, err error) pgdbtemplate.Row {
+	if err != nil {
+		return errRow{err: err}
+	}
+	row, ok := result.(pgdbtemplate.Row)
+	if !ok {
+		return errRow{err: fmt.Errorf("query middleware returned %T instead of a row", result)}
+	}
+	return row
+}
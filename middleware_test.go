@@ -0,0 +1,85 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestQueryMiddleware(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	c.Run("Middlewares wrap Exec and QueryRow in registration order", func(c *qt.C) {
+		c.Parallel()
+		var (
+			mu    sync.Mutex
+			calls []string
+		)
+		recording := func(name string) func(next pgdbtemplatepgx.QueryFunc) pgdbtemplatepgx.QueryFunc {
+			return func(next pgdbtemplatepgx.QueryFunc) pgdbtemplatepgx.QueryFunc {
+				return func(ctx context.Context, kind pgdbtemplatepgx.QueryKind, query string, args ...any) (any, error) {
+					mu.Lock()
+					calls = append(calls, name+" "+kind.String()+": "+query)
+					mu.Unlock()
+					return next(ctx, kind, query, args...)
+				}
+			}
+		}
+
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithQueryMiddleware(recording("outer")),
+			pgdbtemplatepgx.WithQueryMiddleware(recording("inner")),
+		)
+		defer provider.Close()
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+
+		_, err = conn.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.IsNil)
+		var value int
+		c.Assert(conn.QueryRowContext(ctx, "SELECT $1::int", 2).Scan(&value), qt.IsNil)
+		c.Assert(value, qt.Equals, 2)
+
+		c.Assert(calls, qt.DeepEquals, []string{
+			"outer Exec: SELECT 1",
+			"inner Exec: SELECT 1",
+			"outer QueryRow: SELECT $1::int",
+			"inner QueryRow: SELECT $1::int",
+		})
+	})
+
+	c.Run("Middleware can short-circuit queries", func(c *qt.C) {
+		c.Parallel()
+		blocked := errors.New("blocked")
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithQueryMiddleware(func(pgdbtemplatepgx.QueryFunc) pgdbtemplatepgx.QueryFunc {
+				return func(context.Context, pgdbtemplatepgx.QueryKind, string, ...any) (any, error) {
+					return nil, blocked
+				}
+			}),
+		)
+		defer provider.Close()
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+
+		_, err = conn.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.Equals, blocked)
+		var value int
+		c.Assert(conn.QueryRowContext(ctx, "SELECT 1").Scan(&value), qt.Equals, blocked)
+		err = conn.(*pgdbtemplatepgx.DatabaseConnection).ExecMultiple(ctx, "SELECT 1; SELECT 2")
+		c.Assert(err, qt.ErrorIs, blocked)
+	})
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"time"
 
+	"github.com/jackc/pgtype"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"go.opentelemetry.io/otel/metric"
 )
 
 // ConnectionOption configures ConnectionProvider.
@@ -53,3 +55,472 @@ func WithAfterConnect(afterConnect func(context.Context, *pgx.Conn) error) Conne
 		p.poolConfig.AfterConnect = afterConnect
 	}
 }
+
+// WithConnInfoSetup sets a function registering types directly
+// in the type information of every new connection, e.g. custom domains
+// or enums whose OIDs are known up front. It runs before the
+// AfterConnect hook, which can then rely on the registered types.
+func WithConnInfoSetup(fn func(connInfo *pgtype.ConnInfo)) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.connInfoSetup = fn
+	}
+}
+
+// WithAfterConnectRetry retries the AfterConnect hook up to attempts times,
+// waiting backoff between attempts, before the new connection is discarded.
+//
+// This is useful when AfterConnect performs network-dependent setup
+// (e.g. registering remote types) that may fail intermittently.
+// Retries stop early once the connection's context is done.
+// Values of attempts below 2 disable retries.
+func WithAfterConnectRetry(attempts int, backoff time.Duration) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.afterConnectAttempts = attempts
+		p.afterConnectBackoff = backoff
+	}
+}
+
+// WithStrictPoolConfig makes Connect fail with ErrPoolConfigConflict
+// when a pool parameter (e.g. pool_max_conns) is set both in the connection
+// string and via an option such as WithMaxConns.
+//
+// By default, options silently take precedence over the connection string.
+func WithStrictPoolConfig() ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.strictPoolConfig = true
+	}
+}
+
+// PingFailurePolicy controls how Connect reacts when the health check
+// of a freshly created pool fails.
+type PingFailurePolicy int
+
+const (
+	// PingFailureReturnError makes Connect fail immediately
+	// when the health check fails. This is the default.
+	PingFailureReturnError PingFailurePolicy = iota
+	// PingFailureRetry treats a failed health check like a failed
+	// connection attempt, retrying according to WithConnectRetry.
+	PingFailureRetry
+)
+
+// WithConnectRetry retries pool creation up to attempts times,
+// waiting backoff between attempts, when the server cannot be reached.
+// Failures that retrying cannot fix, such as rejected credentials or a
+// missing database, are returned immediately.
+//
+// Retries stop early once the context passed to Connect is done.
+// Values of attempts below 2 disable retries.
+func WithConnectRetry(attempts int, backoff time.Duration) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.connectAttempts = attempts
+		p.connectBackoff = backoff
+	}
+}
+
+// WithPingFailurePolicy sets how Connect reacts when the health check
+// of a freshly created pool fails.
+//
+// In every case the failed pool is closed and never cached.
+func WithPingFailurePolicy(policy PingFailurePolicy) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.pingFailurePolicy = policy
+	}
+}
+
+// WithErrorWrapper sets a function used to annotate parse, connect
+// and ping failures instead of the built-in messages.
+//
+// The function receives one of OpParse, OpConnect or OpPing
+// together with the underlying error, which lets callers map
+// the failures onto their own error conventions.
+func WithErrorWrapper(fn func(op string, err error) error) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.errorWrapper = fn
+	}
+}
+
+// WithSSLMode sets the sslmode used for every connection,
+// overriding any sslmode in the connection string.
+//
+// Valid modes are "disable", "allow", "prefer", "require",
+// "verify-ca" and "verify-full". An invalid mode makes Connect fail.
+func WithSSLMode(mode string) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.sslMode = mode
+	}
+}
+
+// WithGSSEncMode sets the gssencmode used for every connection.
+//
+// Valid modes are "disable", "prefer" and "require". pgx v4 does not
+// implement GSSAPI encryption, so "disable" and "prefer" connect without it,
+// like with no mode set, and "require" makes Connect fail, before dialing,
+// with ErrGSSEncryptionUnsupported instead of silently falling back.
+func WithGSSEncMode(mode string) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.gssEncMode = mode
+	}
+}
+
+// WithSearchPath sets the search_path of every connection
+// to the given schemas, in order.
+//
+// Schema names must be plain identifiers (letters, digits, underscores
+// and dollar signs) or "$user"; any other name makes Connect fail.
+// This overrides a search_path set in the connection string.
+func WithSearchPath(schemas ...string) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.searchPath = schemas
+	}
+}
+
+// WithPingQuery runs the given statement via Exec as the health check,
+// instead of pgxpool's Ping.
+//
+// The query is used after a pool is created as well as by Ping and Healthy.
+// An empty query makes every health check fail.
+func WithPingQuery(query string) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.pingQuery = &query
+	}
+}
+
+// WithMaintenanceDatabase sets the name of the maintenance database,
+// i.e. the database connected to for operations such as CREATE DATABASE.
+//
+// It defaults to "postgres" and should match the AdminDBName
+// given to the pgdbtemplate template manager.
+func WithMaintenanceDatabase(databaseName string) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.maintenanceDatabase = databaseName
+	}
+}
+
+// WithMaintenanceContextFunc sets a function deriving the context used to
+// create the pool for the maintenance database from the caller's context.
+//
+// This allows maintenance connections, which template workflows open
+// with the context of e.g. CreateTestDatabase, to follow a separate
+// (typically more generous) timeout policy than regular queries.
+func WithMaintenanceContextFunc(fn func(parent context.Context) (context.Context, context.CancelFunc)) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.maintenanceContextFunc = fn
+	}
+}
+
+// WithErrorChannel sets a channel receiving a PoolError
+// whenever AfterConnect fails, BeforeAcquire rejects a connection
+// or a health check fails, e.g. for logging or alerting.
+//
+// The provider never blocks on the channel: errors are dropped
+// when it is full, so a buffered channel is recommended.
+func WithErrorChannel(ch chan<- PoolError) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.errorChannel = ch
+	}
+}
+
+// WithCloseTimeout bounds how long ConnectionProvider.Close waits for
+// pools to close. Closing a pool waits for its connections in use
+// to be released, so a connection that was never closed would otherwise
+// make Close block forever, e.g. hanging test teardown.
+//
+// Pools still closing after the timeout are force-closed: the network
+// connections of all of their connections are closed, so the server ends
+// their sessions, and Close reports them with ErrCloseTimeout.
+func WithCloseTimeout(timeout time.Duration) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.closeTimeout = timeout
+	}
+}
+
+// WithIdlePoolTimeout closes and removes a cached pool once it has not
+// been used, by Connect or by a query through a DatabaseConnection,
+// for the timeout, e.g. to release the connections of test databases
+// no longer in use in long-running suites. Pools with connections
+// checked out are not idle. DatabaseConnection handles of a removed
+// pool must not be used afterwards; Connect creates a new pool.
+// Without it, or with a timeout of zero, pools stay open until closed.
+func WithIdlePoolTimeout(timeout time.Duration) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.idlePoolTimeout = timeout
+	}
+}
+
+// WithHardClose makes closing a pool (Close, ClosePoolsFunc,
+// DatabaseConnection.Close, ...) close all of its connections at once
+// by closing their network connections, instead of waiting for
+// connections checked out by callers to be released. The pool finishes
+// closing in the background once they are.
+//
+// Queries in flight on these connections are interrupted and fail,
+// and transactions in flight are rolled back by the server,
+// so this is meant for teardown where nothing is expected to run.
+// By default, pools are closed gracefully.
+func WithHardClose() ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.hardClose = true
+	}
+}
+
+// WithCancelInFlightOnClose makes ConnectionProvider.Close ask the server
+// to cancel the queries running on connections of all pools before
+// closing them, so that a query outliving e.g. a timed-out test does not
+// hold up teardown until it finishes or its own context expires.
+//
+// Canceled queries fail with a query_canceled error. Connections are
+// still released by their holders, so this can be combined with
+// WithCloseTimeout for connections that are never released.
+func WithCancelInFlightOnClose() ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.cancelInFlightOnClose = true
+	}
+}
+
+// WithAutoCreateDatabase makes Connect create databases that do not exist.
+//
+// When connecting fails because the database does not exist, the provider
+// connects to maintenanceDatabase, issues CREATE DATABASE and retries once.
+// It is disabled by default so that a mistyped name is reported
+// rather than silently creating a new database.
+func WithAutoCreateDatabase(maintenanceDatabase string) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.autoCreateFrom = maintenanceDatabase
+	}
+}
+
+// WithMaintenanceConnectionStringFunc sets the function producing the
+// connection string of the maintenance database, for setups where
+// the maintenance endpoint differs entirely (e.g. another host or
+// credentials) from the test databases.
+//
+// It is used whenever the provider connects to the maintenance database
+// (see WithMaintenanceDatabase), including the connections the pgdbtemplate
+// template manager opens to its AdminDBName, so both names must match.
+// When unset, the connection string is connectionStringFunc("postgres"),
+// or generally connectionStringFunc of the maintenance database name.
+func WithMaintenanceConnectionStringFunc(fn func() string) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.maintenanceConnectionStringFunc = fn
+	}
+}
+
+// WithSharedMaintenancePool makes the provider use pool for the
+// maintenance database (see WithMaintenanceDatabase) instead of
+// creating its own, so that several providers, e.g. the one building
+// templates and the one running tests, share a single maintenance pool.
+//
+// The provider does not own the pool: it is used as is, without
+// the provider's pool options, and is never closed by the provider,
+// so the caller must close it after all providers using it.
+func WithSharedMaintenancePool(pool *pgxpool.Pool) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.sharedMaintenancePool = pool
+	}
+}
+
+// WithPoolConfigFunc sets a function customizing the pool configuration
+// per database, e.g. to give a heavily-queried fixture database
+// a larger pool than throwaway ones.
+//
+// The function is called each time a pool is created, with config
+// already parsed from the connection string and updated with the other
+// options (WithMaxConns, WithAfterConnect, ...), so its changes win.
+// MaxConns must remain at least 1.
+func WithPoolConfigFunc(fn func(databaseName string, config *pgxpool.Config)) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.poolConfigFunc = fn
+	}
+}
+
+// WithStatementTimeout sets the statement_timeout of every connection,
+// so that a statement running longer is cancelled by the server
+// instead of wedging a test. Zero disables the timeout.
+func WithStatementTimeout(timeout time.Duration) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.statementTimeout = &timeout
+	}
+}
+
+// WithLockTimeout sets the lock_timeout of every connection,
+// so that a statement waiting longer for a lock fails
+// instead of wedging a test. Zero disables the timeout.
+func WithLockTimeout(timeout time.Duration) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.lockTimeout = &timeout
+	}
+}
+
+// WithDefaultIsolationLevel sets the default_transaction_isolation of every
+// connection, e.g. "serializable", so that transactions started without
+// an explicit isolation level, including those of DatabaseConnection.BeginTx
+// with an empty pgx.TxOptions.IsoLevel, use it. The level is one of
+// "serializable", "repeatable read", "read committed" and "read uncommitted",
+// in any case; Connect fails for other levels.
+func WithDefaultIsolationLevel(level string) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.isolationLevel = level
+	}
+}
+
+// WithLogger sets a logger receiving every query run through
+// a DatabaseConnection, with the database name, SQL and arguments.
+func WithLogger(logger pgx.Logger) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.logger = logger
+	}
+}
+
+// WithContextLoggerFunc sets a function extracting the logger for a query
+// from the query's context, e.g. a logger carrying the trace fields
+// of the request or test, so that query logs can be correlated.
+//
+// When the function returns nil, the logger set via WithLogger is used.
+func WithContextLoggerFunc(fn func(ctx context.Context) pgx.Logger) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.contextLoggerFunc = fn
+	}
+}
+
+// WithPrewarmConcurrency bounds how many pools PrewarmDatabases
+// creates simultaneously. By default, all pools are created at once.
+func WithPrewarmConcurrency(n int) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.prewarmConcurrency = n
+	}
+}
+
+// WithReadinessProbe replaces the single health check of new pools with
+// a readiness probe running query up to attempts times, interval apart,
+// before the pool is cached, so that slow-starting servers do not cause
+// spurious failures. An empty query falls back to the health check
+// statement (see WithPingQuery).
+//
+// Unlike WithConnectRetry, which creates a new pool for each attempt,
+// the probe keeps the pool and only retries the verification.
+func WithReadinessProbe(attempts int, interval time.Duration, query string) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.readinessProbe = &readinessProbe{
+			attempts: attempts,
+			interval: interval,
+			query:    query,
+		}
+	}
+}
+
+// WithPreferSimpleProtocol makes connections use the simple protocol
+// for all queries, interpolating arguments client-side, instead of
+// prepared statements of the extended protocol. This is needed behind
+// poolers that do not support prepared statements, e.g. PgBouncer
+// in transaction pooling mode.
+func WithPreferSimpleProtocol() ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.preferSimpleProtocol = true
+	}
+}
+
+// WithQueryMiddleware adds a middleware wrapping every query run through
+// DatabaseConnection.ExecContext and DatabaseConnection.QueryRowContext,
+// for cross-cutting concerns such as timing, logging or retries.
+//
+// Middlewares compose in registration order: the first one added
+// is the outermost and sees each query first.
+func WithQueryMiddleware(mw func(next QueryFunc) QueryFunc) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.queryMiddlewares = append(p.queryMiddlewares, mw)
+	}
+}
+
+// WithMeter makes the provider emit OpenTelemetry metrics through meter:
+// the number of cached pools and their connections by state, the duration
+// of connection acquisitions and the number of queries run through
+// DatabaseConnection, by database. Without it, no metrics are recorded.
+//
+// Every metric carries a pgdbtemplate.provider.id attribute, so that
+// providers sharing a meter, e.g. one and its ReadOnly counterpart,
+// report distinct series. Pools are no longer observed once the provider
+// is closed.
+func WithMeter(meter metric.Meter) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.meter = meter
+	}
+}
+
+// WithValidateAgainstServerLimits makes Connect fail with
+// ErrServerLimitExceeded instead of caching a new pool if the MaxConns
+// of all pools of the provider together would exceed the server's
+// max_connections, catching over-provisioning in large parallel suites
+// before it causes confusing connection failures.
+//
+// The server's max_connections is read once, through the first pool
+// created, which is usually the maintenance database's.
+func WithValidateAgainstServerLimits() ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.validateServerLimits = true
+	}
+}
+
+// WithReconnectOnAdminShutdown makes DatabaseConnection.ExecContext and
+// DatabaseConnection.QueryRowContext retry a query once if it fails because
+// the server terminated its connection (SQLSTATE 57P01 admin_shutdown or
+// 08006 connection_failure), e.g. after a database restart. A query that
+// fails on a terminated connection before being sent, e.g. with a connection
+// reset while writing it, is retried as well, since the server has not
+// seen it. Before the retry, the idle connections of the pool are closed,
+// since they are likely to have been terminated as well.
+//
+// Retried statements may run twice if the server terminated the connection
+// after executing them, so this is meant for integration tests against
+// restartable databases rather than non-idempotent production writes.
+func WithReconnectOnAdminShutdown() ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.reconnectOnAdminShutdown = true
+	}
+}
+
+// WithOnAcquireSQL runs sql on a connection each time it is acquired from
+// the pool, e.g. to reset session state left behind by a previous user,
+// after the BeforeAcquire hook, if any. A connection on which the statement
+// fails is discarded and another one is acquired, so a statement that
+// always fails makes acquisitions retry until their context is done.
+func WithOnAcquireSQL(sql string) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.onAcquireSQL = sql
+	}
+}
+
+// WithLeakDetection helps catch connections that are never released,
+// e.g. a ConnHandle from AcquireConn without a Release call, a Tx from
+// DatabaseConnection.BeginTx never committed or rolled back, or a row from
+// DatabaseConnection.QueryRowContext never scanned. Whenever a connection
+// acquired through the provider is still held after grace, as measured by
+// the provider's clock, while more than threshold connections of its pool
+// are held that way, onLeak is called with the stack trace captured when
+// it was acquired.
+//
+// It is a debugging aid: capturing stack traces slows acquisitions down.
+// Connections acquired by DatabaseConnection.ExecContext are not tracked,
+// since they are released before it returns.
+func WithLeakDetection(threshold int, grace time.Duration, onLeak func(Leak)) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.leaks = &leakDetector{
+			threshold: threshold,
+			grace:     grace,
+			onLeak:    onLeak,
+		}
+	}
+}
+
+// WithAllowedHosts restricts the provider to the given hosts, as a safety
+// net for shared CI credentials: Connect fails with ErrHostNotAllowed,
+// before dialing, if the connection string for a database points to
+// any other host, e.g. due to a misconfigured connectionStringFunc.
+// Hosts are compared case-insensitively with the host of the connection
+// string and its fallbacks, without resolving names; Unix socket hosts
+// are directory paths. Without hosts, there is no restriction.
+func WithAllowedHosts(hosts ...string) ConnectionOption {
+	return func(p *ConnectionProvider) {
+		p.allowedHosts = hosts
+	}
+}
@@ -0,0 +1,42 @@
+package pgdbtemplatepgxv4
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPoolPaused is returned for databases paused via PausePool.
+var ErrPoolPaused = errors.New("connection pool paused")
+
+// PausePool simulates an outage of the database, e.g. for chaos-style tests
+// asserting that code handles database unavailability gracefully.
+//
+// Until ResumePool is called, Connect and queries through existing
+// DatabaseConnection handles for the database return ErrPoolPaused
+// without touching the server. The pool itself, if any, is kept as is.
+func (p *ConnectionProvider) PausePool(databaseName string) {
+	p.paused.Store(databaseName, struct{}{})
+}
+
+// ResumePool ends the outage of the database started by PausePool.
+func (p *ConnectionProvider) ResumePool(databaseName string) {
+	p.paused.Delete(databaseName)
+}
+
+// checkPaused returns ErrPoolPaused if the database is paused.
+//
+// It does not take p.mu, so that queries never wait on the provider's lock.
+func (p *ConnectionProvider) checkPaused(databaseName string) error {
+	if _, paused := p.paused.Load(databaseName); paused {
+		return fmt.Errorf("%w: %q", ErrPoolPaused, databaseName)
+	}
+	return nil
+}
+
+// checkPaused returns ErrPoolPaused if the database of the connection is paused.
+func (c *DatabaseConnection) checkPaused() error {
+	if c.provider == nil {
+		return nil
+	}
+	return c.provider.checkPaused(c.dbName)
+}
@@ -0,0 +1,99 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/jackc/pgx/v4"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestPausePool(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+	defer provider.Close()
+
+	conn, err := provider.Connect(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+	defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+	pgxConn := conn.(*pgdbtemplatepgx.DatabaseConnection)
+	acquiresBeforePause := pgxConn.Pool.Stat().AcquireCount()
+
+	provider.PausePool("postgres")
+
+	c.Run("Queries fail while paused", func(c *qt.C) {
+		_, err := conn.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.ErrorIs, pgdbtemplatepgx.ErrPoolPaused)
+
+		var value int
+		err = conn.QueryRowContext(ctx, "SELECT 1").Scan(&value)
+		c.Assert(err, qt.ErrorIs, pgdbtemplatepgx.ErrPoolPaused)
+
+		_, err = pgxConn.BeginTx(ctx, pgx.TxOptions{})
+		c.Assert(err, qt.ErrorIs, pgdbtemplatepgx.ErrPoolPaused)
+
+		c.Assert(pgxConn.ExecMultiple(ctx, "SELECT 1; SELECT 2"), qt.ErrorIs, pgdbtemplatepgx.ErrPoolPaused)
+	})
+
+	c.Run("Connect fails while paused", func(c *qt.C) {
+		_, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.ErrorIs, pgdbtemplatepgx.ErrPoolPaused)
+		c.Assert(err, qt.ErrorMatches, `connection pool paused: "postgres"`)
+	})
+
+	c.Run("Server is not touched while paused", func(c *qt.C) {
+		c.Assert(pgxConn.Pool.Stat().AcquireCount(), qt.Equals, acquiresBeforePause)
+	})
+
+	c.Run("Queries succeed after resume", func(c *qt.C) {
+		provider.ResumePool("postgres")
+
+		var value int
+		c.Assert(conn.QueryRowContext(ctx, "SELECT 1").Scan(&value), qt.IsNil)
+		c.Assert(value, qt.Equals, 1)
+
+		_, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+	})
+}
+
+func TestQueriesDoNotWaitOnClosingPools(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	// Both pools connect to the same database.
+	provider := pgdbtemplatepgx.NewConnectionProvider(func(string) string {
+		return testConnectionStringFuncPgx("postgres")
+	})
+	defer provider.Close()
+
+	closing, err := provider.Connect(ctx, "first")
+	c.Assert(err, qt.IsNil)
+	other, err := provider.Connect(ctx, "second")
+	c.Assert(err, qt.IsNil)
+	defer func() { c.Assert(other.Close(), qt.IsNil) }()
+
+	// Closing the first pool blocks until the transaction ends.
+	tx, err := closing.(*pgdbtemplatepgx.DatabaseConnection).BeginTx(ctx, pgx.TxOptions{})
+	c.Assert(err, qt.IsNil)
+	closed := make(chan error, 1)
+	go func() {
+		closed <- closing.Close()
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err = other.ExecContext(queryCtx, "SELECT 1")
+	c.Assert(err, qt.IsNil)
+
+	c.Assert(tx.Rollback(ctx), qt.IsNil)
+	c.Assert(<-closed, qt.IsNil)
+}
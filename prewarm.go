@@ -0,0 +1,55 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// PrewarmDatabases creates the pools for the databases ahead of use,
+// e.g. during test suite setup, so that the first Connect of each test
+// does not pay for dialing the server.
+//
+// Pools are created concurrently, at most as many at a time as set via
+// WithPrewarmConcurrency, to avoid "too many clients" errors when
+// preparing many databases. Databases that already have a pool are skipped.
+// The failures of all databases are returned joined.
+func (p *ConnectionProvider) PrewarmDatabases(ctx context.Context, databaseNames ...string) error {
+	concurrency := p.prewarmConcurrency
+	if concurrency <= 0 || concurrency > len(databaseNames) {
+		concurrency = len(databaseNames)
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, databaseName := range databaseNames {
+		wg.Add(1)
+		go func(databaseName string) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("failed to prewarm database %q: %w", databaseName, ctx.Err()))
+				mu.Unlock()
+				return
+			}
+			defer func() { <-sem }()
+
+			if _, err := p.getOrCreateEntry(ctx, databaseName); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("failed to prewarm database %q: %w", databaseName, err))
+				mu.Unlock()
+			}
+		}(databaseName)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
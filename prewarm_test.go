@@ -0,0 +1,67 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestPrewarmDatabases(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	adminProvider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+	defer adminProvider.Close()
+	adminConn, err := adminProvider.Connect(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+
+	testDBs := make([]string, 6)
+	for i := range testDBs {
+		testDBs[i] = fmt.Sprintf("prewarm_test_%d_%d", time.Now().UnixNano(), i)
+		_, err := adminConn.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE %s", testDBs[i]))
+		c.Assert(err, qt.IsNil)
+	}
+	defer func() {
+		for _, dbName := range testDBs {
+			_, err := adminConn.ExecContext(ctx, fmt.Sprintf("DROP DATABASE %s", dbName))
+			c.Check(err, qt.IsNil)
+		}
+	}()
+
+	c.Run("All databases are prewarmed with bounded concurrency", func(c *qt.C) {
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithPrewarmConcurrency(2),
+		)
+		defer provider.Close()
+
+		err := provider.PrewarmDatabases(ctx, testDBs...)
+		c.Assert(err, qt.IsNil)
+		c.Assert(provider.NumPools(), qt.Equals, len(testDBs))
+
+		// Prewarmed pools are reused by Connect.
+		conn, err := provider.Connect(ctx, testDBs[0])
+		c.Assert(err, qt.IsNil)
+		c.Assert(provider.ReuseCount(testDBs[0]), qt.Equals, int64(1))
+		c.Assert(conn.Close(), qt.IsNil)
+	})
+
+	c.Run("Failures are reported per database", func(c *qt.C) {
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithPrewarmConcurrency(2),
+		)
+		defer provider.Close()
+
+		missing := fmt.Sprintf("prewarm_missing_%d", time.Now().UnixNano())
+		err := provider.PrewarmDatabases(ctx, testDBs[0], missing)
+		c.Assert(err, qt.ErrorMatches, fmt.Sprintf(`failed to prewarm database %q: .*`, missing))
+		c.Assert(provider.NumPools(), qt.Equals, 1)
+	})
+}
@@ -0,0 +1,34 @@
+package pgdbtemplatepgxv4
+
+import (
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// QuoteIdentifier quotes name for use as an SQL identifier,
+// e.g. a table or database name in dynamically built DDL.
+//
+// The name is wrapped in double quotes with embedded double quotes doubled,
+// following pgx.Identifier. NUL bytes, which PostgreSQL does not allow,
+// are removed.
+func QuoteIdentifier(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
+
+// QuoteLiteral quotes value for use as an SQL string literal.
+//
+// Following libpq's PQescapeLiteral, the value is wrapped in single quotes
+// with embedded single quotes doubled. If the value contains backslashes,
+// they are doubled as well and the literal is written in the E'...' escape
+// string syntax, so that it is interpreted the same way regardless of
+// standard_conforming_strings. NUL bytes, which PostgreSQL does not allow,
+// are removed.
+func QuoteLiteral(value string) string {
+	value = strings.ReplaceAll(value, "\x00", "")
+	value = strings.ReplaceAll(value, "'", "''")
+	if strings.Contains(value, `\`) {
+		return `E'` + strings.ReplaceAll(value, `\`, `\\`) + `'`
+	}
+	return `'` + value + `'`
+}
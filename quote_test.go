@@ -0,0 +1,107 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{{
+		name:  "Plain name",
+		input: "users",
+		want:  `"users"`,
+	}, {
+		name:  "Mixed case",
+		input: "MyTable",
+		want:  `"MyTable"`,
+	}, {
+		name:  "Embedded double quotes",
+		input: `my"table`,
+		want:  `"my""table"`,
+	}, {
+		name:  "Special characters",
+		input: "my table; DROP TABLE users; --",
+		want:  `"my table; DROP TABLE users; --"`,
+	}, {
+		name:  "Single quotes and backslashes",
+		input: `it's\here`,
+		want:  `"it's\here"`,
+	}, {
+		name:  "NUL byte",
+		input: "a\x00b",
+		want:  `"ab"`,
+	}, {
+		name:  "Empty name",
+		input: "",
+		want:  `""`,
+	}}
+
+	for _, test := range tests {
+		test := test
+		c.Run(test.name, func(c *qt.C) {
+			c.Parallel()
+			c.Assert(pgdbtemplatepgx.QuoteIdentifier(test.input), qt.Equals, test.want)
+		})
+	}
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{{
+		name:  "Plain value",
+		input: "hello",
+		want:  `'hello'`,
+	}, {
+		name:  "Embedded single quotes",
+		input: "it's",
+		want:  `'it''s'`,
+	}, {
+		name:  "Injection attempt",
+		input: "'; DROP TABLE users; --",
+		want:  `'''; DROP TABLE users; --'`,
+	}, {
+		name:  "Backslashes",
+		input: `C:\path\to`,
+		want:  `E'C:\\path\\to'`,
+	}, {
+		name:  "Backslash and single quote",
+		input: `\'`,
+		want:  `E'\\'''`,
+	}, {
+		name:  "Double quotes and newline",
+		input: "say \"hi\"\n",
+		want:  "'say \"hi\"\n'",
+	}, {
+		name:  "NUL byte",
+		input: "a\x00b",
+		want:  `'ab'`,
+	}, {
+		name:  "Empty value",
+		input: "",
+		want:  `''`,
+	}}
+
+	for _, test := range tests {
+		test := test
+		c.Run(test.name, func(c *qt.C) {
+			c.Parallel()
+			c.Assert(pgdbtemplatepgx.QuoteLiteral(test.input), qt.Equals, test.want)
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ReadOnly returns a provider for the same databases whose sessions
+// are read-only, as a guard-rail for helper code that should only query.
+//
+// Every connection of the returned provider has default_transaction_read_only
+// enabled, so statements that write (INSERT, UPDATE, CREATE TABLE, ...)
+// fail with a read_only_sql_transaction error, while queries pass through.
+// It is not a security boundary: a session can still turn the setting off.
+//
+// The returned provider is created with the same options as p,
+// has its own pools and must be closed independently.
+func (p *ConnectionProvider) ReadOnly() *ConnectionProvider {
+	opts := make([]ConnectionOption, 0, len(p.opts)+1)
+	opts = append(opts, p.opts...)
+	opts = append(opts, func(p *ConnectionProvider) {
+		p.readOnly = true
+	})
+	return NewConnectionProvider(p.connectionStringFunc, opts...)
+}
+
+// setReadOnly makes transactions of the session read-only by default.
+func setReadOnly(ctx context.Context, conn *pgx.Conn) error {
+	if _, err := conn.Exec(ctx, "SET default_transaction_read_only = on"); err != nil {
+		return fmt.Errorf("failed to make session read-only: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestReadOnly(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	var afterConnectCalls atomic.Int32
+	provider := pgdbtemplatepgx.NewConnectionProvider(
+		testConnectionStringFuncPgx,
+		pgdbtemplatepgx.WithMaxConns(1),
+		pgdbtemplatepgx.WithAfterConnect(func(context.Context, *pgx.Conn) error {
+			afterConnectCalls.Add(1)
+			return nil
+		}),
+	)
+	defer provider.Close()
+
+	conn, err := provider.Connect(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+
+	tableName := fmt.Sprintf("read_only_test_%d", time.Now().UnixNano())
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (id int)", tableName))
+	c.Assert(err, qt.IsNil)
+	defer func() {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf("DROP TABLE %s", tableName))
+		c.Assert(err, qt.IsNil)
+	}()
+
+	readOnly := provider.ReadOnly()
+	defer readOnly.Close()
+
+	roConn, err := readOnly.Connect(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+
+	c.Run("Writes fail", func(c *qt.C) {
+		_, err := roConn.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (id) VALUES (1)", tableName))
+		var pgErr *pgconn.PgError
+		c.Assert(errors.As(err, &pgErr), qt.IsTrue)
+		c.Assert(pgErr.Code, qt.Equals, "25006") // read_only_sql_transaction.
+	})
+
+	c.Run("Queries pass through", func(c *qt.C) {
+		var count int
+		err := roConn.QueryRowContext(ctx, fmt.Sprintf("SELECT count(*) FROM %s", tableName)).Scan(&count)
+		c.Assert(err, qt.IsNil)
+		c.Assert(count, qt.Equals, 0)
+	})
+
+	c.Run("Options are inherited", func(c *qt.C) {
+		// Both providers ran the user-provided AfterConnect.
+		c.Assert(afterConnectCalls.Load(), qt.Equals, int32(2))
+	})
+
+	c.Run("Original provider stays writable", func(c *qt.C) {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (id) VALUES (1)", tableName))
+		c.Assert(err, qt.IsNil)
+	})
+}
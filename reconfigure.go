@@ -0,0 +1,118 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"fmt"
+)
+
+// ReconfigureDatabase replaces the cached pool for the database with
+// a new pool created with the provider's options followed by opts,
+// e.g. to raise WithMaxConns while a suite ramps up concurrency,
+// which pgxpool cannot do on a live pool.
+//
+// The new pool is created and verified before it replaces the old one,
+// and is subject to WithValidateAgainstServerLimits like pools created
+// by Connect. DatabaseConnection handles obtained before keep working
+// against the old pool until closed: their Close leaves the new pool
+// untouched, and the old pool is closed with the last of them.
+// Connect returns handles of the new pool.
+//
+// The options only apply to the new pool: pools created later for
+// the database, e.g. by RefreshIfStale, use the provider's options.
+// Observability options (WithMeter, WithLeakDetection) cannot be changed.
+// ErrPoolNotFound is returned if the provider has no pool for the database.
+func (p *ConnectionProvider) ReconfigureDatabase(ctx context.Context, databaseName string, opts ...ConnectionOption) error {
+	old, err := p.lookupEntry(databaseName)
+	if err != nil {
+		return err
+	}
+
+	fresh, err := p.withOptions(opts).createEntry(ctx, databaseName)
+	if err == nil && p.validateServerLimits {
+		if err = p.loadServerMaxConns(ctx, fresh.pool); err != nil {
+			fresh.close()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reconfigure pool: %w", err)
+	}
+
+	p.mu.Lock()
+	current, exists := p.pools[databaseName]
+	if !exists || current != old {
+		p.mu.Unlock()
+		fresh.close()
+		return fmt.Errorf("%w: %q", ErrPoolNotFound, databaseName)
+	}
+	// The old pool stays open while it has handles, so it counts
+	// towards the server limits.
+	keepOld := old.handles.Load() > 0
+	if keepOld {
+		p.replaced[old] = databaseName
+	}
+	if err := p.checkServerLimits(databaseName, fresh.pool); err != nil {
+		delete(p.replaced, old)
+		p.mu.Unlock()
+		fresh.close()
+		return err
+	}
+	old.retire()
+	old.replaced = true
+	p.pools[databaseName] = fresh
+	p.reapWhenIdle(databaseName, fresh)
+	if !keepOld {
+		p.closeReplacedEntry(databaseName, old)
+	}
+	p.mu.Unlock()
+	return nil
+}
+
+// closeReplaced releases the handle of a pool replaced by
+// ReconfigureDatabase, closing the pool with its last handle.
+//
+// The caller must hold the provider's mu.
+func (c *DatabaseConnection) closeReplaced() error {
+	if c.closed {
+		return fmt.Errorf("%w: %q", ErrPoolAlreadyClosed, c.dbName)
+	}
+	c.closed = true
+
+	if c.entry.handles.Add(-1) > 0 {
+		return nil
+	}
+	if _, open := c.provider.replaced[c.entry]; !open {
+		// The provider has been closed in the meantime.
+		return fmt.Errorf("%w: %q", ErrPoolAlreadyClosed, c.dbName)
+	}
+	delete(c.provider.replaced, c.entry)
+	c.entry.close()
+	return nil
+}
+
+// withOptions returns a provider configured with the options of p
+// followed by opts, used to create pools on behalf of p.
+//
+// Unlike NewConnectionProvider, it shares the metrics, leak detector,
+// clock and test hooks of p instead of creating its own.
+func (p *ConnectionProvider) withOptions(opts []ConnectionOption) *ConnectionProvider {
+	derived := &ConnectionProvider{
+		connectionStringFunc: p.connectionStringFunc,
+		pools:                make(map[string]*poolEntry),
+		creations:            make(map[string]*poolCreation),
+		replaced:             make(map[*poolEntry]string),
+		maintenanceDatabase:  defaultMaintenanceDatabase,
+	}
+	for _, opt := range p.opts {
+		opt(derived)
+	}
+	for _, opt := range opts {
+		opt(derived)
+	}
+
+	derived.opts = append(append([]ConnectionOption(nil), p.opts...), opts...)
+	derived.metrics = p.metrics
+	derived.leaks = p.leaks
+	derived.clock = p.clock
+	derived.pingHook = p.pingHook
+	return derived
+}
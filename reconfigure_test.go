@@ -0,0 +1,128 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestReconfigureDatabase(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	c.Run("MaxConns is raised", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithMaxConns(2),
+		)
+		defer provider.Close()
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		stat, err := provider.Stats("postgres")
+		c.Assert(err, qt.IsNil)
+		c.Assert(stat.MaxConns(), qt.Equals, int32(2))
+
+		// A connection acquired from the old pool outlives the swap.
+		handle, err := provider.AcquireConn(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+
+		err = provider.ReconfigureDatabase(ctx, "postgres", pgdbtemplatepgx.WithMaxConns(5))
+		c.Assert(err, qt.IsNil)
+
+		stat, err = provider.Stats("postgres")
+		c.Assert(err, qt.IsNil)
+		c.Assert(stat.MaxConns(), qt.Equals, int32(5))
+
+		_, err = handle.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.IsNil)
+		handle.Release()
+		c.Assert(conn.Close(), qt.IsNil)
+
+		conn, err = provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		c.Assert(conn.(*pgdbtemplatepgx.DatabaseConnection).Pool.Config().MaxConns, qt.Equals, int32(5))
+		_, err = conn.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.IsNil)
+		c.Assert(conn.Close(), qt.IsNil)
+	})
+
+	c.Run("Old handles keep working until closed", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithMaxConns(2),
+		)
+		defer provider.Close()
+
+		first, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		second, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		oldPool := first.(*pgdbtemplatepgx.DatabaseConnection).Pool
+
+		err = provider.ReconfigureDatabase(ctx, "postgres", pgdbtemplatepgx.WithMaxConns(5))
+		c.Assert(err, qt.IsNil)
+
+		// Both old handles query the old pool after the swap.
+		_, err = first.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.IsNil)
+		var one int
+		c.Assert(second.QueryRowContext(ctx, "SELECT 1").Scan(&one), qt.IsNil)
+		c.Assert(one, qt.Equals, 1)
+
+		// Closing an old handle leaves the other one and the new pool working.
+		c.Assert(first.Close(), qt.IsNil)
+		c.Assert(first.Close(), qt.ErrorIs, pgdbtemplatepgx.ErrPoolAlreadyClosed)
+		_, err = second.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.IsNil)
+
+		// The old pool is closed with its last handle.
+		c.Assert(second.Close(), qt.IsNil)
+		c.Assert(oldPool.Ping(ctx), qt.IsNotNil)
+
+		stat, err := provider.Stats("postgres")
+		c.Assert(err, qt.IsNil)
+		c.Assert(stat.MaxConns(), qt.Equals, int32(5))
+	})
+
+	c.Run("Server limits are enforced", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithMaxConns(1),
+			pgdbtemplatepgx.WithValidateAgainstServerLimits(),
+		)
+		defer provider.Close()
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+
+		var serverMaxConns int32
+		err = conn.QueryRowContext(ctx, "SELECT current_setting('max_connections')::int").Scan(&serverMaxConns)
+		c.Assert(err, qt.IsNil)
+
+		err = provider.ReconfigureDatabase(ctx, "postgres", pgdbtemplatepgx.WithMaxConns(serverMaxConns))
+		c.Assert(err, qt.ErrorIs, pgdbtemplatepgx.ErrServerLimitExceeded)
+
+		// The old pool is kept.
+		stat, err := provider.Stats("postgres")
+		c.Assert(err, qt.IsNil)
+		c.Assert(stat.MaxConns(), qt.Equals, int32(1))
+	})
+
+	c.Run("Missing pool", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		err := provider.ReconfigureDatabase(ctx, "postgres", pgdbtemplatepgx.WithMaxConns(5))
+		c.Assert(err, qt.ErrorIs, pgdbtemplatepgx.ErrPoolNotFound)
+	})
+}
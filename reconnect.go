@@ -0,0 +1,88 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"errors"
+
+	"github.com/andrei-polukhin/pgdbtemplate"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// SQLSTATE codes of connections terminated by the server.
+const (
+	adminShutdownCode     = "57P01"
+	connectionFailureCode = "08006"
+)
+
+// isTerminatedConnection reports whether err is caused by the server
+// having terminated the connection, e.g. on an administrator restart,
+// or by a connection that broke before the query was sent: pgconn reports
+// the latter as safe to retry, e.g. when writing the query to a connection
+// reset by the server fails, rather than with the SQLSTATE, which is lost.
+func isTerminatedConnection(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == adminShutdownCode || pgErr.Code == connectionFailureCode
+	}
+	return pgconn.SafeToRetry(err)
+}
+
+// reconnectQueryFunc wraps next so that a query failing because the
+// server terminated its connection is retried once, after resetting
+// the pool. Rows of QueryRow queries retry when scanned, since pgx
+// only reports their errors then.
+func reconnectQueryFunc(pool *pgxpool.Pool, next QueryFunc) QueryFunc {
+	return func(ctx context.Context, kind QueryKind, query string, args ...any) (any, error) {
+		result, err := next(ctx, kind, query, args...)
+		if kind == QueryRow && err == nil {
+			row, ok := result.(pgdbtemplate.Row)
+			if !ok {
+				return result, nil
+			}
+			return reconnectRow{
+				row: row,
+				retry: func() pgdbtemplate.Row {
+					resetPool(ctx, pool)
+					return asRow(next(ctx, kind, query, args...))
+				},
+			}, nil
+		}
+		if !isTerminatedConnection(err) {
+			return result, err
+		}
+
+		resetPool(ctx, pool)
+		return next(ctx, kind, query, args...)
+	}
+}
+
+// reconnectRow is a row retrying its query once if scanning it fails
+// because the server terminated the connection.
+type reconnectRow struct {
+	row   pgdbtemplate.Row
+	retry func() pgdbtemplate.Row
+}
+
+// Scan implements pgdbtemplate.Row.Scan.
+func (r reconnectRow) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+	if !isTerminatedConnection(err) {
+		return err
+	}
+	return r.retry().Scan(dest...)
+}
+
+// resetPool closes the idle connections of the pool, which are likely
+// to have been terminated together with the failed one, so that the
+// retried query runs on a new connection.
+func resetPool(ctx context.Context, pool *pgxpool.Pool) {
+	for _, conn := range pool.AcquireAllIdle(ctx) {
+		// The connection is discarded either way.
+		_ = conn.Conn().Close(ctx)
+		conn.Release()
+	}
+}
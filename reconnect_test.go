@@ -0,0 +1,131 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/jackc/pgconn"
+
+	"github.com/andrei-polukhin/pgdbtemplate"
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestReconnectOnAdminShutdown(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	admin := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+	defer admin.Close()
+	adminConn, err := admin.Connect(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+
+	// terminate terminates the only backend of the connection's pool
+	// and waits for it to be gone.
+	terminate := func(c *qt.C, conn pgdbtemplate.DatabaseConnection) uint32 {
+		var pid uint32
+		c.Assert(conn.QueryRowContext(ctx, "SELECT pg_backend_pid()").Scan(&pid), qt.IsNil)
+		_, err := adminConn.ExecContext(ctx, "SELECT pg_terminate_backend($1)", int64(pid))
+		c.Assert(err, qt.IsNil)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			var exists bool
+			err := adminConn.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_stat_activity WHERE pid = $1)", int64(pid)).Scan(&exists)
+			c.Assert(err, qt.IsNil)
+			if !exists {
+				return pid
+			}
+			c.Assert(time.Now().Before(deadline), qt.IsTrue, qt.Commentf("backend %d still running", pid))
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	c.Run("Queries are retried on a new connection", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithMaxConns(1),
+			pgdbtemplatepgx.WithReconnectOnAdminShutdown(),
+		)
+		defer provider.Close()
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+
+		terminate(c, conn)
+		_, err = conn.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.IsNil)
+
+		terminated := terminate(c, conn)
+		var pid uint32
+		err = conn.QueryRowContext(ctx, "SELECT pg_backend_pid()").Scan(&pid)
+		c.Assert(err, qt.IsNil)
+		c.Assert(pid, qt.Not(qt.Equals), terminated)
+	})
+
+	c.Run("Without the option the query fails", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithMaxConns(1),
+		)
+		defer provider.Close()
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+
+		terminate(c, conn)
+		_, err = conn.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.Not(qt.IsNil))
+	})
+}
+
+// safeToRetryError is a failure pgconn reports as safe to retry,
+// like the failure to send a query on a reset connection.
+type safeToRetryError struct{}
+
+func (safeToRetryError) Error() string     { return "write: connection reset by peer" }
+func (safeToRetryError) SafeToRetry() bool { return true }
+
+func TestIsTerminatedConnection(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+
+	for _, test := range []struct {
+		about string
+		err   error
+		want  bool
+	}{{
+		about: "admin shutdown",
+		err:   &pgconn.PgError{Code: "57P01"},
+		want:  true,
+	}, {
+		about: "connection failure",
+		err:   fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: "08006"}),
+		want:  true,
+	}, {
+		about: "query not sent on a reset connection",
+		err:   fmt.Errorf("wrapped: %w", safeToRetryError{}),
+		want:  true,
+	}, {
+		about: "other server error",
+		err:   &pgconn.PgError{Code: "57P02"},
+	}, {
+		about: "network error after sending the query",
+		err:   &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")},
+	}, {
+		about: "no error",
+	}} {
+		c.Run(test.about, func(c *qt.C) {
+			c.Assert(pgdbtemplatepgx.IsTerminatedConnection(test.err), qt.Equals, test.want)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package pgdbtemplatepgxv4
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// ErrPoolAlreadyRegistered is returned by RegisterPool when the provider
+// already has a pool for the database.
+var ErrPoolAlreadyRegistered = errors.New("pool already registered for database")
+
+// RegisterPool makes the provider use an existing pool for the database,
+// e.g. one created by the application under test, instead of creating one.
+//
+// The provider takes ownership of the pool: it is closed like the pools
+// the provider creates. ErrPoolAlreadyRegistered is returned if the provider
+// already has a pool for the database, or is creating one; use
+// RegisterPoolReplace to replace it.
+func (p *ConnectionProvider) RegisterPool(databaseName string, pool *pgxpool.Pool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exists := p.pools[databaseName]; exists {
+		return fmt.Errorf("%w: %q", ErrPoolAlreadyRegistered, databaseName)
+	}
+	if _, inFlight := p.creations[databaseName]; inFlight {
+		return fmt.Errorf("%w: %q", ErrPoolAlreadyRegistered, databaseName)
+	}
+	entry := p.newRegisteredEntry(pool)
+	p.pools[databaseName] = entry
+	p.reapWhenIdle(databaseName, entry)
+	return nil
+}
+
+// RegisterPoolReplace is like RegisterPool, but replaces the pool
+// the provider already has for the database, if any.
+//
+// The replaced pool is closed in the background, once its connections
+// in use are released, and returned, or nil if there was none, so that
+// the caller can tell which pool has been replaced. A pool creation
+// in flight for the database keeps the registered pool and discards
+// its own.
+func (p *ConnectionProvider) RegisterPoolReplace(databaseName string, pool *pgxpool.Pool) (old *pgxpool.Pool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if replaced, exists := p.pools[databaseName]; exists {
+		p.closeReplacedEntry(databaseName, replaced)
+		old = replaced.pool
+	}
+	entry := p.newRegisteredEntry(pool)
+	p.pools[databaseName] = entry
+	p.reapWhenIdle(databaseName, entry)
+	return old
+}
+
+// newRegisteredEntry returns a new pool entry for a pool registered
+// by the caller, which the provider has not configured.
+func (p *ConnectionProvider) newRegisteredEntry(pool *pgxpool.Pool) *poolEntry {
+	entry := p.newEntry(pool)
+	entry.external = true
+	return entry
+}
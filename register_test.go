@@ -0,0 +1,124 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/andrei-polukhin/pgdbtemplate"
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestRegisterPool(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	newPool := func(c *qt.C, applicationName string) *pgxpool.Pool {
+		connString := withConnParam(testConnectionStringFuncPgx("postgres"), "application_name", applicationName)
+		pool, err := pgxpool.Connect(ctx, connString)
+		c.Assert(err, qt.IsNil)
+		return pool
+	}
+	applicationName := func(c *qt.C, conn pgdbtemplate.DatabaseConnection) string {
+		var name string
+		c.Assert(conn.QueryRowContext(ctx, "SELECT current_setting('application_name')").Scan(&name), qt.IsNil)
+		return name
+	}
+
+	c.Run("Registered pool is used by Connect", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		pool := newPool(c, "registered")
+		c.Assert(provider.RegisterPool("postgres", pool), qt.IsNil)
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		c.Assert(conn.(*pgdbtemplatepgx.DatabaseConnection).Pool, qt.Equals, pool)
+		c.Assert(applicationName(c, conn), qt.Equals, "registered")
+	})
+
+	c.Run("Registering over an existing pool fails", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		c.Assert(provider.RegisterPool("postgres", newPool(c, "first")), qt.IsNil)
+
+		second := newPool(c, "second")
+		defer second.Close()
+		err := provider.RegisterPool("postgres", second)
+		c.Assert(err, qt.ErrorIs, pgdbtemplatepgx.ErrPoolAlreadyRegistered)
+	})
+
+	c.Run("Replaced pool is returned", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		c.Assert(provider.RegisterPoolReplace("postgres", newPool(c, "first")), qt.IsNil)
+		oldConn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		oldPool := oldConn.(*pgdbtemplatepgx.DatabaseConnection).Pool
+
+		old := provider.RegisterPoolReplace("postgres", newPool(c, "second"))
+		c.Assert(old, qt.Equals, oldPool)
+		c.Assert(provider.NumPools(), qt.Equals, 1)
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		c.Assert(applicationName(c, conn), qt.Equals, "second")
+
+		// The old pool is closed in the background.
+		deadline := time.Now().Add(5 * time.Second)
+		for old.Ping(ctx) == nil {
+			c.Assert(time.Now().Before(deadline), qt.IsTrue, qt.Commentf("replaced pool still open"))
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	c.Run("Registering during a pool creation", func(c *qt.C) {
+		c.Parallel()
+		pinging := make(chan struct{})
+		release := make(chan struct{})
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithPingHook(func(context.Context) error {
+				close(pinging)
+				<-release
+				return nil
+			}),
+		)
+		defer provider.Close()
+
+		type result struct {
+			conn pgdbtemplate.DatabaseConnection
+			err  error
+		}
+		results := make(chan result, 1)
+		go func() {
+			conn, err := provider.Connect(ctx, "postgres")
+			results <- result{conn, err}
+		}()
+		<-pinging
+
+		// The creation in flight counts as an existing pool.
+		pool := newPool(c, "registered")
+		err := provider.RegisterPool("postgres", pool)
+		c.Assert(err, qt.ErrorIs, pgdbtemplatepgx.ErrPoolAlreadyRegistered)
+
+		// A replacing pool is kept, and the created one is discarded.
+		c.Assert(provider.RegisterPoolReplace("postgres", pool), qt.IsNil)
+		close(release)
+		res := <-results
+		c.Assert(res.err, qt.IsNil)
+		c.Assert(res.conn.(*pgdbtemplatepgx.DatabaseConnection).Pool, qt.Equals, pool)
+		c.Assert(provider.NumPools(), qt.Equals, 1)
+		c.Assert(applicationName(c, res.conn), qt.Equals, "registered")
+	})
+}
@@ -0,0 +1,58 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// ErrServerLimitExceeded is returned by Connect when WithValidateAgainstServerLimits
+// is used and the pools of the provider could open more connections
+// than the server's max_connections.
+var ErrServerLimitExceeded = errors.New("pool sizes exceed server max_connections")
+
+// loadServerMaxConns reads the server's max_connections through the pool,
+// unless it has already been read.
+func (p *ConnectionProvider) loadServerMaxConns(ctx context.Context, pool *pgxpool.Pool) error {
+	if p.serverMaxConns.Load() > 0 {
+		return nil
+	}
+
+	var maxConns int32
+	if err := pool.QueryRow(ctx, "SELECT current_setting('max_connections')::int").Scan(&maxConns); err != nil {
+		return fmt.Errorf("failed to read server max_connections: %w", err)
+	}
+	p.serverMaxConns.Store(maxConns)
+	return nil
+}
+
+// checkServerLimits returns ErrServerLimitExceeded if caching the pool
+// for the database would make the MaxConns of all pools exceed the
+// server's max_connections. It is a no-op unless
+// WithValidateAgainstServerLimits has been used.
+//
+// The caller must hold p.mu.
+func (p *ConnectionProvider) checkServerLimits(databaseName string, pool *pgxpool.Pool) error {
+	serverMaxConns := p.serverMaxConns.Load()
+	if !p.validateServerLimits || serverMaxConns <= 0 {
+		return nil
+	}
+
+	total := pool.Config().MaxConns
+	for name, entry := range p.pools {
+		if name != databaseName {
+			total += entry.pool.Config().MaxConns
+		}
+	}
+	// Pools replaced by ReconfigureDatabase are open until their last handle closes.
+	for entry := range p.replaced {
+		total += entry.pool.Config().MaxConns
+	}
+	if total > serverMaxConns {
+		return fmt.Errorf("%w: %d connections configured with database %q, server allows %d",
+			ErrServerLimitExceeded, total, databaseName, serverMaxConns)
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Stats returns a snapshot of the statistics of the cached pool
+// for the database.
+//
+// ErrPoolNotFound is returned if the provider has no pool for the database.
+func (p *ConnectionProvider) Stats(databaseName string) (*pgxpool.Stat, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	entry, exists := p.pools[databaseName]
+	if !exists {
+		return nil, fmt.Errorf("%w: %q", ErrPoolNotFound, databaseName)
+	}
+	return entry.pool.Stat(), nil
+}
+
+// Saturated reports whether every connection the pool for the database
+// may open is currently acquired, so that load-generating tests can back off.
+//
+// ErrPoolNotFound is returned if the provider has no pool for the database.
+func (p *ConnectionProvider) Saturated(databaseName string) (bool, error) {
+	stat, err := p.Stats(databaseName)
+	if err != nil {
+		return false, err
+	}
+	return stat.AcquiredConns() >= stat.MaxConns(), nil
+}
+
+// ErrConnectionsAcquired is returned by AssertNoLeaks for each pool
+// with connections still acquired.
+var ErrConnectionsAcquired = errors.New("connections still acquired")
+
+// AssertNoLeaks returns an error naming every database whose pool
+// has connections still acquired, e.g. to be called when tearing down
+// a test suite to catch forgotten Release or Rollback calls.
+//
+// The errors wrap ErrConnectionsAcquired and are joined with errors.Join
+// in database name order. Nil is returned if no connection is acquired.
+func (p *ConnectionProvider) AssertNoLeaks() error {
+	p.mu.RLock()
+	acquired := make(map[string]int32, len(p.pools))
+	names := make([]string, 0, len(p.pools))
+	for databaseName, entry := range p.pools {
+		if n := entry.pool.Stat().AcquiredConns(); n > 0 {
+			acquired[databaseName] = n
+			names = append(names, databaseName)
+		}
+	}
+	p.mu.RUnlock()
+	sort.Strings(names)
+
+	errs := make([]error, 0, len(names))
+	for _, databaseName := range names {
+		errs = append(errs, fmt.Errorf("%w: %q has %d", ErrConnectionsAcquired, databaseName, acquired[databaseName]))
+	}
+	return errors.Join(errs...)
+}
+
+// WaitStats returns how many acquisitions from the pool for the database
+// had to wait for a connection because none was idle, and how many
+// were canceled while waiting, which pinpoints pool starvation
+// in parallel suites.
+//
+// ErrPoolNotFound is returned if the provider has no pool for the database.
+func (p *ConnectionProvider) WaitStats(databaseName string) (empty, canceled int64, err error) {
+	stat, err := p.Stats(databaseName)
+	if err != nil {
+		return 0, 0, err
+	}
+	return stat.EmptyAcquireCount(), stat.CanceledAcquireCount(), nil
+}
+
+// QueryCounts returns how many ExecContext and QueryRowContext calls
+// have been made through DatabaseConnection handles for the database,
+// e.g. to assert that caching or batching reduced the number of queries.
+//
+// The counters belong to the cached pool: they start from zero
+// when the pool is created and are both zero if the provider
+// has no pool for the database.
+func (p *ConnectionProvider) QueryCounts(databaseName string) (exec, query int64) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	entry, exists := p.pools[databaseName]
+	if !exists {
+		return 0, 0
+	}
+	return entry.execCount.Load(), entry.queryCount.Load()
+}
+
+// ReuseCount returns how many times the cached pool for the database
+// has been reused by Connect (or AcquireConn and WithSameConn)
+// instead of creating a new pool.
+//
+// It helps asserting that pool caching works across a test suite.
+// The count starts from zero when the pool is created and is zero
+// if the provider has no pool for the database.
+func (p *ConnectionProvider) ReuseCount(databaseName string) int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	entry, exists := p.pools[databaseName]
+	if !exists {
+		return 0
+	}
+	return entry.reuseCount.Load()
+}
+
+// serverParameterNames are the parameters reported by the server
+// at connection start-up returned by ServerParameters.
+var serverParameterNames = []string{
+	"application_name",
+	"client_encoding",
+	"DateStyle",
+	"default_transaction_read_only",
+	"in_hot_standby",
+	"integer_datetimes",
+	"IntervalStyle",
+	"is_superuser",
+	"server_encoding",
+	"server_version",
+	"session_authorization",
+	"standard_conforming_strings",
+	"TimeZone",
+}
+
+// ServerParameters returns the parameters the server reported
+// for a connection of the cached pool for the database,
+// such as server_version, TimeZone or integer_datetimes,
+// without issuing SHOW queries.
+//
+// Parameters not reported by the server version are omitted.
+// ErrPoolNotFound is returned if the provider has no pool for the database.
+//
+// The connection is acquired like by DatabaseConnection queries: the pool
+// is marked as used and the acquisition is measured (see WithMeter)
+// and tracked (see WithLeakDetection). No query is sent, so the query
+// middlewares are not involved.
+func (p *ConnectionProvider) ServerParameters(ctx context.Context, databaseName string) (map[string]string, error) {
+	entry, err := p.lookupEntry(databaseName)
+	if err != nil {
+		return nil, err
+	}
+
+	dbConn := p.queryConnection(databaseName, entry)
+	if err := dbConn.checkPaused(); err != nil {
+		return nil, err
+	}
+	dbConn.touch()
+	conn, err := dbConn.acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	params := make(map[string]string, len(serverParameterNames))
+	for _, name := range serverParameterNames {
+		if value := conn.Conn().PgConn().ParameterStatus(name); value != "" {
+			params[name] = value
+		}
+	}
+	return params, nil
+}
+
+// ProviderSnapshot is a consistent view of the pools of a provider,
+// returned by Snapshot.
+type ProviderSnapshot struct {
+	// NumPools is the number of cached pools.
+	NumPools int
+	// Databases holds the view of each cached pool by database name.
+	Databases map[string]DatabaseSnapshot
+}
+
+// DatabaseSnapshot is the view of a single pool in a ProviderSnapshot.
+type DatabaseSnapshot struct {
+	// Stat holds the statistics of the pool.
+	Stat *pgxpool.Stat
+	// ReuseCount is the number of times the pool has been reused (see ReuseCount).
+	ReuseCount int64
+	// ExecCount and QueryCount are the query counters (see QueryCounts).
+	ExecCount  int64
+	QueryCount int64
+	// LastUsed is when the pool was last used (see LastUsed).
+	LastUsed time.Time
+}
+
+// Snapshot returns the statistics, counters and last-used times
+// of all cached pools, read at once under the provider's lock,
+// e.g. for dumping diagnostics at the end of a test run.
+func (p *ConnectionProvider) Snapshot() ProviderSnapshot {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	snapshot := ProviderSnapshot{
+		NumPools:  len(p.pools),
+		Databases: make(map[string]DatabaseSnapshot, len(p.pools)),
+	}
+	for databaseName, entry := range p.pools {
+		snapshot.Databases[databaseName] = DatabaseSnapshot{
+			Stat:       entry.pool.Stat(),
+			ReuseCount: entry.reuseCount.Load(),
+			ExecCount:  entry.execCount.Load(),
+			QueryCount: entry.queryCount.Load(),
+			LastUsed:   entry.lastUsedAt(),
+		}
+	}
+	return snapshot
+}
+
+// EffectiveProtocol returns the query protocol used by the cached pool
+// for the database according to its configuration: "simple" if
+// PreferSimpleProtocol is set (e.g. via WithPreferSimpleProtocol
+// or a connection string parameter), "extended" otherwise.
+//
+// The second return value is false if the provider has no pool
+// for the database.
+func (p *ConnectionProvider) EffectiveProtocol(databaseName string) (string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	entry, exists := p.pools[databaseName]
+	if !exists {
+		return "", false
+	}
+	if entry.pool.Config().ConnConfig.PreferSimpleProtocol {
+		return "simple", true
+	}
+	return "extended", true
+}
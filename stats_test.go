@@ -0,0 +1,349 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestStats(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	c.Run("Stats of an existing pool", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithMaxConns(3),
+		)
+		defer provider.Close()
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+
+		stat, err := provider.Stats("postgres")
+		c.Assert(err, qt.IsNil)
+		c.Assert(stat.MaxConns(), qt.Equals, int32(3))
+		c.Assert(stat.AcquiredConns(), qt.Equals, int32(0))
+	})
+
+	c.Run("Missing pool", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		_, err := provider.Stats("postgres")
+		c.Assert(errors.Is(err, pgdbtemplatepgx.ErrPoolNotFound), qt.IsTrue)
+		_, err = provider.Saturated("postgres")
+		c.Assert(errors.Is(err, pgdbtemplatepgx.ErrPoolNotFound), qt.IsTrue)
+	})
+
+	c.Run("Saturated pool", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithMaxConns(1),
+		)
+		defer provider.Close()
+
+		handle, err := provider.AcquireConn(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+
+		saturated, err := provider.Saturated("postgres")
+		c.Assert(err, qt.IsNil)
+		c.Assert(saturated, qt.IsTrue)
+
+		handle.Release()
+		saturated, err = provider.Saturated("postgres")
+		c.Assert(err, qt.IsNil)
+		c.Assert(saturated, qt.IsFalse)
+	})
+}
+
+func TestWaitStats(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	c.Run("Waiting acquisitions are counted", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithMaxConns(1),
+		)
+		defer provider.Close()
+
+		handle, err := provider.AcquireConn(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		emptyBefore, canceledBefore, err := provider.WaitStats("postgres")
+		c.Assert(err, qt.IsNil)
+
+		// The pool is saturated, so the acquisition waits until it gives up.
+		waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		_, err = provider.AcquireConn(waitCtx, "postgres")
+		c.Assert(err, qt.IsNotNil)
+
+		// This acquisition waits until the held connection is released.
+		acquired := make(chan error, 1)
+		go func() {
+			waiter, err := provider.AcquireConn(ctx, "postgres")
+			if err == nil {
+				waiter.Release()
+			}
+			acquired <- err
+		}()
+		time.Sleep(100 * time.Millisecond)
+		handle.Release()
+		c.Assert(<-acquired, qt.IsNil)
+
+		empty, canceled, err := provider.WaitStats("postgres")
+		c.Assert(err, qt.IsNil)
+		c.Assert(empty-emptyBefore, qt.Equals, int64(1))
+		c.Assert(canceled-canceledBefore, qt.Equals, int64(1))
+	})
+
+	c.Run("Missing pool", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		_, _, err := provider.WaitStats("postgres")
+		c.Assert(err, qt.ErrorIs, pgdbtemplatepgx.ErrPoolNotFound)
+	})
+}
+
+func TestAssertNoLeaks(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+	defer provider.Close()
+
+	// No pools, no leaks.
+	c.Assert(provider.AssertNoLeaks(), qt.IsNil)
+
+	handle, err := provider.AcquireConn(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+
+	err = provider.AssertNoLeaks()
+	c.Assert(err, qt.ErrorIs, pgdbtemplatepgx.ErrConnectionsAcquired)
+	c.Assert(err.Error(), qt.Equals, `connections still acquired: "postgres" has 1`)
+
+	handle.Release()
+	c.Assert(provider.AssertNoLeaks(), qt.IsNil)
+}
+
+func TestQueryCounts(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+	defer provider.Close()
+
+	exec, query := provider.QueryCounts("postgres")
+	c.Assert(exec, qt.Equals, int64(0))
+	c.Assert(query, qt.Equals, int64(0))
+
+	conn1, err := provider.Connect(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+	conn2, err := provider.Connect(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+	defer func() { c.Assert(conn1.Close(), qt.IsNil) }()
+
+	for i := 0; i < 3; i++ {
+		_, err := conn1.ExecContext(ctx, "SELECT 1")
+		c.Assert(err, qt.IsNil)
+	}
+	var value int
+	c.Assert(conn1.QueryRowContext(ctx, "SELECT 1").Scan(&value), qt.IsNil)
+	// Handles of the same pool share the counters.
+	c.Assert(conn2.QueryRowContext(ctx, "SELECT 2").Scan(&value), qt.IsNil)
+
+	exec, query = provider.QueryCounts("postgres")
+	c.Assert(exec, qt.Equals, int64(3))
+	c.Assert(query, qt.Equals, int64(2))
+}
+
+func TestReuseCount(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+	defer provider.Close()
+
+	c.Assert(provider.ReuseCount("postgres"), qt.Equals, int64(0))
+
+	// The first Connect creates the pool.
+	conn, err := provider.Connect(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+	c.Assert(provider.ReuseCount("postgres"), qt.Equals, int64(0))
+
+	for i := 0; i < 3; i++ {
+		_, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+	}
+	c.Assert(provider.ReuseCount("postgres"), qt.Equals, int64(3))
+
+	// Recreating the pool starts over.
+	c.Assert(conn.Close(), qt.IsNil)
+	c.Assert(provider.ReuseCount("postgres"), qt.Equals, int64(0))
+	conn, err = provider.Connect(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+	defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+	c.Assert(provider.ReuseCount("postgres"), qt.Equals, int64(0))
+}
+
+func TestServerParameters(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+	defer provider.Close()
+
+	c.Run("Missing pool", func(c *qt.C) {
+		_, err := provider.ServerParameters(ctx, "postgres")
+		c.Assert(err, qt.ErrorIs, pgdbtemplatepgx.ErrPoolNotFound)
+	})
+
+	c.Run("Parameters of an existing pool", func(c *qt.C) {
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+
+		params, err := provider.ServerParameters(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		c.Assert(params["server_version"], qt.Not(qt.Equals), "")
+		c.Assert(params["integer_datetimes"], qt.Equals, "on")
+
+		var serverVersion string
+		c.Assert(conn.QueryRowContext(ctx, "SHOW server_version").Scan(&serverVersion), qt.IsNil)
+		c.Assert(params["server_version"], qt.Equals, serverVersion)
+	})
+
+	c.Run("Pool is used like by queries", func(c *qt.C) {
+		start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		fc := &fakeClock{now: start}
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithClock(fc),
+		)
+		defer provider.Close()
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+
+		fc.Advance(time.Hour)
+		_, err = provider.ServerParameters(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		lastUsed, ok := provider.LastUsed("postgres")
+		c.Assert(ok, qt.IsTrue)
+		c.Assert(lastUsed.Equal(start.Add(time.Hour)), qt.IsTrue)
+
+		provider.PausePool("postgres")
+		_, err = provider.ServerParameters(ctx, "postgres")
+		c.Assert(err, qt.ErrorIs, pgdbtemplatepgx.ErrPoolPaused)
+		provider.ResumePool("postgres")
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	provider := pgdbtemplatepgx.NewConnectionProvider(
+		testConnectionStringFuncPgx,
+		pgdbtemplatepgx.WithMaxConns(3),
+	)
+	defer provider.Close()
+
+	snapshot := provider.Snapshot()
+	c.Assert(snapshot.NumPools, qt.Equals, 0)
+	c.Assert(snapshot.Databases, qt.HasLen, 0)
+
+	conn, err := provider.Connect(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+	defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+	_, err = provider.Connect(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+
+	_, err = conn.ExecContext(ctx, "SELECT 1")
+	c.Assert(err, qt.IsNil)
+	var value int
+	c.Assert(conn.QueryRowContext(ctx, "SELECT 2").Scan(&value), qt.IsNil)
+
+	snapshot = provider.Snapshot()
+	c.Assert(snapshot.NumPools, qt.Equals, 1)
+	db, ok := snapshot.Databases["postgres"]
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(db.Stat.MaxConns(), qt.Equals, int32(3))
+	c.Assert(db.ReuseCount, qt.Equals, int64(1))
+	c.Assert(db.ExecCount, qt.Equals, int64(1))
+	c.Assert(db.QueryCount, qt.Equals, int64(1))
+	lastUsed, _ := provider.LastUsed("postgres")
+	c.Assert(db.LastUsed.Equal(lastUsed), qt.IsTrue)
+}
+
+func TestEffectiveProtocol(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	c.Run("Simple protocol", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithPreferSimpleProtocol(),
+		)
+		defer provider.Close()
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+
+		protocol, ok := provider.EffectiveProtocol("postgres")
+		c.Assert(ok, qt.IsTrue)
+		c.Assert(protocol, qt.Equals, "simple")
+
+		// Arguments are interpolated client-side.
+		var value int
+		c.Assert(conn.QueryRowContext(ctx, "SELECT $1::int", 42).Scan(&value), qt.IsNil)
+		c.Assert(value, qt.Equals, 42)
+	})
+
+	c.Run("Extended protocol by default", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+
+		protocol, ok := provider.EffectiveProtocol("postgres")
+		c.Assert(ok, qt.IsTrue)
+		c.Assert(protocol, qt.Equals, "extended")
+	})
+
+	c.Run("Missing pool", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+		defer provider.Close()
+
+		_, ok := provider.EffectiveProtocol("postgres")
+		c.Assert(ok, qt.IsFalse)
+	})
+}
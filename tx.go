@@ -0,0 +1,79 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/andrei-polukhin/pgdbtemplate"
+	"github.com/jackc/pgx/v4"
+)
+
+// Tx is a transaction started via DatabaseConnection.BeginTx.
+//
+// Commit and Rollback return the failure of an earlier Commit or Rollback
+// joined with their own, so that the usual deferred Rollback after
+// a failed Commit does not hide the original failure.
+// The connection of the transaction is released back to the pool
+// by the first Commit or Rollback; later calls are safe.
+//
+// A Tx must not be used concurrently.
+type Tx struct {
+	tx pgx.Tx
+	// err is the failure of an earlier Commit or Rollback.
+	err error
+}
+
+// BeginTx starts a transaction on a connection acquired from the pool.
+//
+// The caller must end the transaction with Commit or Rollback;
+// deferring Rollback right away is the recommended pattern.
+func (c *DatabaseConnection) BeginTx(ctx context.Context, opts pgx.TxOptions) (*Tx, error) {
+	c.touch()
+	if err := c.checkPaused(); err != nil {
+		return nil, err
+	}
+
+	tx, err := c.Pool.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if c.provider != nil {
+		c.provider.trackAcquire(c.entry, c.dbName, tx.Conn())
+	}
+	return &Tx{tx: tx}, nil
+}
+
+// ExecContext executes a query within the transaction.
+func (t *Tx) ExecContext(ctx context.Context, query string, args ...any) (any, error) {
+	return t.tx.Exec(ctx, query, args...)
+}
+
+// QueryRowContext executes a query returning a single row within the transaction.
+func (t *Tx) QueryRowContext(ctx context.Context, query string, args ...any) pgdbtemplate.Row {
+	return t.tx.QueryRow(ctx, query, args...)
+}
+
+// Commit commits the transaction.
+func (t *Tx) Commit(ctx context.Context) error {
+	if err := t.tx.Commit(ctx); err != nil {
+		t.fail(fmt.Errorf("failed to commit transaction: %w", err))
+	}
+	return t.err
+}
+
+// Rollback rolls the transaction back.
+//
+// Like pgx, it reports pgx.ErrTxClosed if the transaction has already
+// been committed or rolled back.
+func (t *Tx) Rollback(ctx context.Context) error {
+	if err := t.tx.Rollback(ctx); err != nil {
+		t.fail(fmt.Errorf("failed to roll back transaction: %w", err))
+	}
+	return t.err
+}
+
+// fail records a failure, keeping earlier ones.
+func (t *Tx) fail(err error) {
+	t.err = errors.Join(t.err, err)
+}
@@ -0,0 +1,139 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestTx(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+	defer provider.Close()
+
+	conn, err := provider.Connect(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+	pgxConn := conn.(*pgdbtemplatepgx.DatabaseConnection)
+
+	// The deferred constraint makes duplicates fail only at commit time.
+	tableName := fmt.Sprintf("tx_test_%d", time.Now().UnixNano())
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (id int UNIQUE DEFERRABLE INITIALLY DEFERRED)", tableName))
+	c.Assert(err, qt.IsNil)
+	defer func() {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf("DROP TABLE %s", tableName))
+		c.Assert(err, qt.IsNil)
+	}()
+
+	count := func(c *qt.C, id int) int {
+		var n int
+		err := conn.QueryRowContext(ctx, fmt.Sprintf("SELECT count(*) FROM %s WHERE id = $1", tableName), id).Scan(&n)
+		c.Assert(err, qt.IsNil)
+		return n
+	}
+
+	c.Run("Commit", func(c *qt.C) {
+		tx, err := pgxConn.BeginTx(ctx, pgx.TxOptions{})
+		c.Assert(err, qt.IsNil)
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (id) VALUES (1)", tableName))
+		c.Assert(err, qt.IsNil)
+
+		var n int
+		err = tx.QueryRowContext(ctx, fmt.Sprintf("SELECT count(*) FROM %s", tableName)).Scan(&n)
+		c.Assert(err, qt.IsNil)
+		c.Assert(n, qt.Equals, 1)
+
+		c.Assert(tx.Commit(ctx), qt.IsNil)
+		c.Assert(count(c, 1), qt.Equals, 1)
+
+		// Rolling back a committed transaction reports it like pgx does.
+		c.Assert(errors.Is(tx.Rollback(ctx), pgx.ErrTxClosed), qt.IsTrue)
+	})
+
+	c.Run("Rollback", func(c *qt.C) {
+		tx, err := pgxConn.BeginTx(ctx, pgx.TxOptions{})
+		c.Assert(err, qt.IsNil)
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (id) VALUES (2)", tableName))
+		c.Assert(err, qt.IsNil)
+
+		c.Assert(tx.Rollback(ctx), qt.IsNil)
+		c.Assert(count(c, 2), qt.Equals, 0)
+	})
+
+	c.Run("Failed commit followed by rollback", func(c *qt.C) {
+		tx, err := pgxConn.BeginTx(ctx, pgx.TxOptions{})
+		c.Assert(err, qt.IsNil)
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (id) VALUES (3), (3)", tableName))
+		c.Assert(err, qt.IsNil)
+
+		commitErr := tx.Commit(ctx)
+		var pgErr *pgconn.PgError
+		c.Assert(errors.As(commitErr, &pgErr), qt.IsTrue)
+		c.Assert(pgErr.Code, qt.Equals, "23505") // unique_violation.
+
+		// The deferred Rollback reports both failures.
+		rollbackErr := tx.Rollback(ctx)
+		c.Assert(errors.As(rollbackErr, &pgErr), qt.IsTrue)
+		c.Assert(pgErr.Code, qt.Equals, "23505")
+		c.Assert(errors.Is(rollbackErr, pgx.ErrTxClosed), qt.IsTrue)
+		c.Assert(count(c, 3), qt.Equals, 0)
+
+		// The connection has been released exactly once.
+		stat, err := provider.Stats("postgres")
+		c.Assert(err, qt.IsNil)
+		c.Assert(stat.AcquiredConns(), qt.Equals, int32(0))
+	})
+}
+
+func TestDefaultIsolationLevel(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	c.Run("Transactions use the default isolation level", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithDefaultIsolationLevel("SERIALIZABLE"),
+		)
+		defer provider.Close()
+
+		conn, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.IsNil)
+		defer func() { c.Assert(conn.Close(), qt.IsNil) }()
+
+		var level string
+		err = conn.QueryRowContext(ctx, "SELECT current_setting('transaction_isolation')").Scan(&level)
+		c.Assert(err, qt.IsNil)
+		c.Assert(level, qt.Equals, "serializable")
+
+		tx, err := conn.(*pgdbtemplatepgx.DatabaseConnection).BeginTx(ctx, pgx.TxOptions{})
+		c.Assert(err, qt.IsNil)
+		err = tx.QueryRowContext(ctx, "SELECT current_setting('transaction_isolation')").Scan(&level)
+		c.Assert(err, qt.IsNil)
+		c.Assert(level, qt.Equals, "serializable")
+		c.Assert(tx.Rollback(ctx), qt.IsNil)
+	})
+
+	c.Run("Unknown isolation level", func(c *qt.C) {
+		c.Parallel()
+		provider := pgdbtemplatepgx.NewConnectionProvider(
+			testConnectionStringFuncPgx,
+			pgdbtemplatepgx.WithDefaultIsolationLevel("snapshot"),
+		)
+		defer provider.Close()
+
+		_, err := provider.Connect(ctx, "postgres")
+		c.Assert(err, qt.ErrorMatches, `failed to apply pool config: unknown isolation level "snapshot"`)
+	})
+}
@@ -0,0 +1,52 @@
+package pgdbtemplatepgxv4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrObjectsMissing is returned by VerifyObjectsExist when some
+// of the expected objects do not exist.
+var ErrObjectsMissing = errors.New("database objects missing")
+
+// VerifyObjectsExist checks that the relations (tables, views, sequences,
+// indexes, ...) exist in the database, so that a template database lacking
+// expected objects, e.g. due to misconfigured migrations, fails fast.
+//
+// Object names are resolved like in queries: they may be schema-qualified
+// and are otherwise looked up in the search path. ErrObjectsMissing is
+// returned listing the missing objects. The pool is created if it does not
+// exist yet.
+func (p *ConnectionProvider) VerifyObjectsExist(ctx context.Context, databaseName string, objects []string) error {
+	entry, err := p.getOrCreateEntry(ctx, databaseName)
+	if err != nil {
+		return err
+	}
+
+	rows, err := entry.pool.Query(ctx,
+		"SELECT name FROM unnest($1::text[]) WITH ORDINALITY AS o(name, i) WHERE to_regclass(name) IS NULL ORDER BY i",
+		objects)
+	if err != nil {
+		return fmt.Errorf("failed to check database objects: %w", err)
+	}
+	defer rows.Close()
+
+	var missing []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("failed to check database objects: %w", err)
+		}
+		missing = append(missing, name)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to check database objects: %w", err)
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w in database %q: %s", ErrObjectsMissing, databaseName, strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package pgdbtemplatepgxv4_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	pgdbtemplatepgx "github.com/andrei-polukhin/pgdbtemplate-pgx-v4"
+)
+
+func TestVerifyObjectsExist(t *testing.T) {
+	t.Parallel()
+	c := qt.New(t)
+	ctx := context.Background()
+
+	provider := pgdbtemplatepgx.NewConnectionProvider(testConnectionStringFuncPgx)
+	defer provider.Close()
+
+	conn, err := provider.Connect(ctx, "postgres")
+	c.Assert(err, qt.IsNil)
+
+	tableName := fmt.Sprintf("test_table_%d", time.Now().UnixNano())
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (id int)", tableName))
+	c.Assert(err, qt.IsNil)
+	defer func() {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf("DROP TABLE %s", tableName))
+		c.Assert(err, qt.IsNil)
+	}()
+
+	c.Run("Existing objects", func(c *qt.C) {
+		err := provider.VerifyObjectsExist(ctx, "postgres", []string{tableName, "public." + tableName, "pg_catalog.pg_class"})
+		c.Assert(err, qt.IsNil)
+	})
+
+	c.Run("Missing objects are listed", func(c *qt.C) {
+		err := provider.VerifyObjectsExist(ctx, "postgres", []string{"bogus_table", tableName, "public.bogus_view"})
+		c.Assert(err, qt.ErrorIs, pgdbtemplatepgx.ErrObjectsMissing)
+		c.Assert(err, qt.ErrorMatches, `database objects missing in database "postgres": bogus_table, public.bogus_view`)
+	})
+
+	c.Run("No objects", func(c *qt.C) {
+		c.Assert(provider.VerifyObjectsExist(ctx, "postgres", nil), qt.IsNil)
+	})
+}